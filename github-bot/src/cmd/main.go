@@ -1,72 +1,194 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v41/github"
+	"golang.org/x/oauth2"
 
 	"github.com/wenjielee1/github-bot/handlers"
 	"github.com/wenjielee1/github-bot/services"
 	"github.com/wenjielee1/github-bot/utils"
 )
 
-// Constants for the repository owner and name.
-const (
-	owner      = "EmbeddedLLM"
-	repository = "JAM.ai.dev"
-)
+// defaultListenAddr is the address the webhook server listens on when TRIAGE_BOT_LISTEN_ADDR is not set.
+const defaultListenAddr = ":8080"
 
 // main is the entry point of the GitHub bot application.
 // It retrieves necessary credentials from environment variables, generates tokens,
-// and starts handling GitHub events.
+// and starts handling GitHub events. When started with the "serve" argument, it runs
+// a long-lived webhook server instead of handling a single GitHub Actions event.
+// The "baseline" argument prints a secrets baseline accepting the current findings of a pull request.
+// The "usage" argument prints a report of the recorded token usage and needs no credentials.
+// With --sarif out.sarif, the findings of the handled event are also written to a SARIF file.
+//
+// A GitHub Actions run exits with 0 if it is clean, 1 if a finding is at or above the severity threshold
+// (secrets.fail_on of the repository, or --fail-on) and 2 if a check could not run.
 func main() {
+	// Mask detected secrets in everything the bot logs, as Actions logs of public repositories are public
+	log.SetOutput(utils.NewRedactingWriter(os.Stderr))
+
+	sarifPath := flag.String("sarif", "", "write the findings of the event to this SARIF 2.1.0 file")
+	failOn := flag.String("fail-on", "", "lowest severity of findings that fails the run: high, medium, low or none (default: the repository's secrets.fail_on)")
+	flag.Parse()
+	if *failOn != "" && !services.ValidFailOn(*failOn) {
+		fatalf("Error: --fail-on must be high, medium, low or none, not %q", *failOn)
+	}
+	command, args := flag.Arg(0), flag.Args()
+	if len(args) > 0 {
+		args = args[1:]
+	}
+
+	if command == "usage" {
+		usage(args)
+		return
+	}
+
 	log.Println("Starting the GitHub bot")
 	// Retrieve the GitHub App ID from environment variables.
 	// The GitHub App ID is a unique identifier for the GitHub App. It is assigned by GitHub when the app is created.
 	appIDStr := os.Getenv("TRIAGE_BOT_APP_ID")
 	log.Printf("APP_ID: %s", appIDStr)
 
-	// Retrieve the Installation ID from environment variables.
-	// The Installation ID is a unique identifier for the installation of the GitHub App on a specific repository or organization.
-	installationIDStr := os.Getenv("TRIAGE_BOT_INSTALLATION_ID")
-	log.Printf("INSTALLATION_ID: %s", installationIDStr)
-
-	// Retrieve the private key from environment variables and decode it from base64 format.
-	// The private key is used to sign JWT tokens for authenticating as the GitHub App.
-	privateKeyBase64 := os.Getenv("TRIAGE_BOT_PRIVATE_KEY")
-
 	// Convert appIDStr to int64.
 	appID, err := strconv.ParseInt(appIDStr, 10, 64)
 	if err != nil {
-		log.Fatalf("Error converting APP_ID to int64: %v", err)
+		fatalf("Error converting APP_ID to int64: %v", err)
 	}
 
-	// Convert installationIDStr to int64.
-	installationID, err := strconv.ParseInt(installationIDStr, 10, 64)
+	// Load the private key from TRIAGE_BOT_PRIVATE_KEY_FILE or TRIAGE_BOT_PRIVATE_KEY.
+	// The private key is used to sign JWT tokens for authenticating as the GitHub App.
+	privateKey, err := utils.LoadPrivateKey()
 	if err != nil {
-		log.Fatalf("Error converting INSTALLATION_ID to int64: %v", err)
+		fatalf("Error loading private key: %v", err)
 	}
 
-	// Decode the private key from base64 format.
-	privateKey, err := utils.DecodePrivateKey(privateKeyBase64)
-	if err != nil {
-		log.Fatalf("Error decoding private key: %v", err)
+	// Installation tokens are minted per installation named in each event payload.
+	// The installation ID in TRIAGE_BOT_INSTALLATION_ID is only used for events that do not name one.
+	tokens := services.NewInstallationTokens(appID, privateKey)
+
+	switch command {
+	case "serve":
+		serve(tokens)
+		return
+	case "baseline":
+		baseline(tokens, args)
+		return
 	}
 
-	// Generate a JWT token for authentication.
-	// The JWT token is used to authenticate as the GitHub App and is required to perform actions on behalf of the app.
-	jwtToken, err := utils.GenerateJWT(appID, privateKey)
+	// Handle the GitHub Actions event, authenticating as the installation it belongs to.
+	results, err := handlers.HandleGitHubEvents(tokens)
 	if err != nil {
-		log.Fatalf("Error generating JWT: %v", err)
+		fatalf("%v", err)
 	}
 
-	// Retrieve the installation token using the JWT token.
-	// The installation token is used to authenticate API requests for a specific installation of the GitHub App.
-	installationToken, err := services.GetInstallationToken(installationID, jwtToken)
-	if err != nil {
-		log.Fatalf("Error getting installation token: %v", err)
+	// Export the findings, even if there are none, so that code scanning closes fixed alerts
+	if *sarifPath != "" {
+		if err := services.WriteSarifFile(*sarifPath, results.Findings()); err != nil {
+			fatalf("Error writing SARIF: %v", err)
+		}
+		log.Printf("Wrote %d findings to %s", len(results.Findings()), *sarifPath)
+	}
+
+	code := results.ExitCode(*failOn)
+	switch code {
+	case services.ExitFindings:
+		log.Printf("Failing the run: findings at or above the severity threshold")
+	case services.ExitInfraError:
+		log.Printf("Failing the run: %d checks could not run completely", len(results.Errors()))
 	}
+	os.Exit(code)
+}
 
-	// Handle GitHub events using the installation token.
-	handlers.HandleGitHubEvents(utils.GetRepoOwner(owner), utils.GetRepoName(repository), installationToken)
+// fatalf logs the error and exits with the infrastructure error code, which tells branch protection that
+// the checks did not run rather than that they found something.
+func fatalf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+	os.Exit(services.ExitInfraError)
+}
+
+// serve runs the webhook server until the process is stopped.
+// Every delivery is verified against TRIAGE_BOT_WEBHOOK_SECRET before it is handled.
+func serve(tokens *services.InstallationTokens) {
+	webhookSecret := os.Getenv("TRIAGE_BOT_WEBHOOK_SECRET")
+	if webhookSecret == "" {
+		fatalf("Error: TRIAGE_BOT_WEBHOOK_SECRET environment variable not set")
+	}
+
+	addr := os.Getenv("TRIAGE_BOT_LISTEN_ADDR")
+	if addr == "" {
+		addr = defaultListenAddr
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/webhook", &handlers.WebhookHandler{
+		Secret: webhookSecret,
+		Tokens: tokens,
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	log.Printf("Listening for webhooks on %s/webhook", addr)
+	if err := server.ListenAndServe(); err != nil {
+		fatalf("Error running webhook server: %v", err)
+	}
+}
+
+// usage prints the token usage recorded in the usage store, optionally limited to one repository.
+func usage(args []string) {
+	flags := flag.NewFlagSet("usage", flag.ExitOnError)
+	days := flags.Int("days", 7, "number of days to report, including today")
+	repo := flags.String("repo", "", "only report this repository (owner/name)")
+	flags.Parse(args)
+
+	if err := services.DefaultUsageStore().Report(os.Stdout, *repo, *days); err != nil {
+		fatalf("Error reading usage: %v", err)
+	}
+}
+
+// baseline prints a secrets baseline that accepts every current secret finding of a pull request,
+// merged with the baseline on the pull request's base branch. Commit the output as .jambu-secrets-baseline.
+func baseline(tokens *services.InstallationTokens, args []string) {
+	flags := flag.NewFlagSet("baseline", flag.ExitOnError)
+	repoName := flags.String("repo", "", "the repository of the pull request (owner/name)")
+	prNumber := flags.Int("pr", 0, "the number of the pull request")
+	flags.Parse(args)
+
+	owner, repo, ok := strings.Cut(*repoName, "/")
+	if !ok || owner == "" || repo == "" || *prNumber <= 0 {
+		fatalf("Usage: github_bot baseline -repo owner/name -pr number")
+	}
+
+	// Use the configured installation, or look up the App's installation on the repository
+	ctx := context.Background()
+	installationID := utils.GetInstallationID()
+	if installationID == 0 {
+		var err error
+		installationID, err = tokens.RepositoryInstallation(ctx, owner, repo)
+		if err != nil {
+			fatalf("Error finding installation: %v", err)
+		}
+	}
+	client := github.NewClient(oauth2.NewClient(ctx, tokens.TokenSource(installationID)))
+
+	content, err := services.GenerateSecretsBaseline(ctx, client, owner, repo, *prNumber)
+	if err != nil {
+		fatalf("Error generating secrets baseline: %v", err)
+	}
+	fmt.Print(content)
 }
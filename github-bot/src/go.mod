@@ -6,6 +6,7 @@ require (
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/google/go-github/v41 v41.0.0
 	golang.org/x/oauth2 v0.21.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
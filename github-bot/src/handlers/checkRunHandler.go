@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"log"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/wenjielee1/github-bot/models"
+	"github.com/wenjielee1/github-bot/services"
+)
+
+// HandleCheckRunEvent processes GitHub check run events. When a user re-runs one of the bot's check runs,
+// only that check runs again, on the current head of the pull request the check run belongs to.
+func HandleCheckRunEvent(ctx context.Context, client *github.Client, llm services.LLMProvider, config *models.BotConfig, owner, repo string, eventPayload models.EventPayload) {
+	// Only re-run requests are handled, the bot creates and completes its check runs itself
+	if eventPayload.Action != "rerequested" {
+		log.Printf("Unhandled check run action: %s", eventPayload.Action)
+		return
+	}
+
+	// Check if the check run data is present in the event payload
+	checkRun := eventPayload.CheckRun
+	if checkRun == nil {
+		log.Println("No check run data found in payload")
+		return
+	}
+	// Other Apps and workflows can create check runs with the same names, only the bot's own are re-run
+	if !services.IsOwnApp(ctx, checkRun.App.ID) {
+		log.Printf("Check run %s on %s was created by App %d, not by the bot, ignoring", checkRun.Name, checkRun.HeadSHA, checkRun.App.ID)
+		return
+	}
+	if len(checkRun.PullRequests) == 0 {
+		log.Printf("Check run %s on %s does not belong to a pull request of %s/%s", checkRun.Name, checkRun.HeadSHA, owner, repo)
+		return
+	}
+
+	// Fetch the pull request, as the check run only carries its number
+	ghPR, _, err := client.PullRequests.Get(ctx, owner, repo, checkRun.PullRequests[0].Number)
+	if err != nil {
+		log.Printf("Error fetching PR #%d: %v", checkRun.PullRequests[0].Number, err)
+		services.RecordError(ctx, err)
+		return
+	}
+	pr := &models.PullRequest{
+		Number:       ghPR.GetNumber(),
+		ChangedFiles: ghPR.GetChangedFiles(),
+		DiffURL:      ghPR.GetDiffURL(),
+	}
+	pr.Head.SHA = ghPR.GetHead().GetSHA()
+	pr.Head.Ref = ghPR.GetHead().GetRef()
+	pr.Base.SHA = ghPR.GetBase().GetSHA()
+	pr.Base.Ref = ghPR.GetBase().GetRef()
+	if pr.Head.SHA != checkRun.HeadSHA {
+		log.Printf("PR #%d moved on from %s, re-running %s on %s", pr.Number, checkRun.HeadSHA, checkRun.Name, pr.Head.SHA)
+	}
+
+	// Re-run only the requested check, if it is still enabled. A re-run scans every commit again.
+	log.Printf("Re-running %s on pull request: #%d", checkRun.Name, pr.Number)
+	switch checkRun.Name {
+	case services.SecretsCheckRunName:
+		if config.Checks.Secrets {
+			services.CheckSecretKeyLeakage(ctx, client, llm, config, owner, repo, pr, "")
+		}
+	case services.ChangelogCheckRunName:
+		if config.Checks.Changelog {
+			services.CheckChangelogUpdated(ctx, client, llm, config, owner, repo, pr)
+		}
+	default:
+		log.Printf("Unknown check run: %s", checkRun.Name)
+	}
+}
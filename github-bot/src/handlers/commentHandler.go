@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/wenjielee1/github-bot/models"
+	"github.com/wenjielee1/github-bot/services"
+	"github.com/wenjielee1/github-bot/utils"
+)
+
+// writeAssociations are the author associations of users who may run commands on any pull request.
+var writeAssociations = map[string]bool{"OWNER": true, "MEMBER": true, "COLLABORATOR": true}
+
+// HandleIssueCommentEvent processes GitHub issue comment events. Comments on pull requests that start with a
+// command, such as "/jambu apply-changelog", run the command and are answered with a comment.
+func HandleIssueCommentEvent(ctx context.Context, client *github.Client, config *models.BotConfig, owner, repo string, eventPayload models.EventPayload) {
+	// Check if the comment is a command on a pull request
+	command := commandOf(eventPayload)
+	if command == "" {
+		log.Println("Comment is not a command, ignoring")
+		return
+	}
+	issue, comment := eventPayload.Issue, eventPayload.Comment
+	log.Printf("Running %q from %s on pull request: #%d", command, comment.User.Login, issue.Number)
+
+	// Commands change the pull request's branch, so only its author and people with write access may run them
+	var reply string
+	switch {
+	case command != services.ApplyChangelogCommand:
+		reply = fmt.Sprintf("Jambo! I do not know the command `%s`. Comment `%s` to commit the suggested changelog section.", command, services.ApplyChangelogCommand)
+	case comment.User.Login != issue.User.Login && !writeAssociations[comment.AuthorAssociation]:
+		reply = "Jambo! Only the author of this pull request and people with write access to the repository can run commands."
+	case !config.Checks.Changelog:
+		reply = "Jambo! The changelog check is disabled in this repository's configuration."
+	default:
+		var err error
+		reply, err = services.ApplyChangelog(ctx, client, config, owner, repo, issue.Number)
+		if err != nil {
+			log.Printf("Error applying the changelog section to PR #%d: %v", issue.Number, err)
+			services.RecordError(ctx, err)
+			reply = "Jambo! I could not commit the changelog section, please try again later."
+		}
+	}
+
+	// Answer the command
+	body := fmt.Sprintf("> %s\n\n%s", command, reply)
+	if _, _, err := client.Issues.CreateComment(ctx, owner, repo, issue.Number, &github.IssueComment{Body: github.String(utils.Redact(ctx, body))}); err != nil {
+		log.Printf("Error replying to %q on PR #%d: %v", command, issue.Number, err)
+		services.RecordError(ctx, err)
+	}
+}
+
+// commandOf returns the command a newly created comment on a pull request starts with, or an empty string if it
+// is not a command. Comments of bots are never commands, so that the bot does not act on its own replies.
+func commandOf(eventPayload models.EventPayload) string {
+	issue, comment := eventPayload.Issue, eventPayload.Comment
+	if eventPayload.Action != "created" || issue == nil || issue.PullRequest == nil || comment == nil || comment.User.Type == "Bot" {
+		return ""
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(comment.Body), "\n")
+	line = strings.Join(strings.Fields(line), " ")
+	if !strings.HasPrefix(line, "/jambu ") {
+		return ""
+	}
+	return line
+}
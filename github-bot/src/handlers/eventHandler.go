@@ -3,30 +3,23 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
 	"github.com/google/go-github/v41/github"
 	"github.com/wenjielee1/github-bot/models"
 	"github.com/wenjielee1/github-bot/services"
 	"github.com/wenjielee1/github-bot/utils"
 	"golang.org/x/oauth2"
-	"io/ioutil"
-	"log"
-	"os"
-	"strings"
 )
 
-// HandleGitHubEvents processes GitHub events by reading event data,
-// initializing necessary services, and delegating to specific event handlers.
-func HandleGitHubEvents(owner, repo, token string) {
-	// Create a new context
-	ctx := context.Background()
-
-	// Initialize the OAuth2 token source and client
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
-
+// HandleGitHubEvents processes the GitHub event of the current GitHub Actions run by reading
+// the event data from the runner and delegating to HandleEvent. It returns the findings of the checks that ran,
+// or an error if the event could not be handled at all.
+func HandleGitHubEvents(tokens *services.InstallationTokens) (*services.RunResults, error) {
 	// Get the GitHub event name and path from environment variables
 	eventName := os.Getenv("GITHUB_EVENT_NAME")
 	eventPath := os.Getenv("GITHUB_EVENT_PATH")
@@ -37,53 +30,146 @@ func HandleGitHubEvents(owner, repo, token string) {
 	// Read the event data from the file
 	eventData, err := ioutil.ReadFile(eventPath)
 	if err != nil {
-		log.Fatalf("Error reading event data: %v", err)
+		return services.NewRunResults(), fmt.Errorf("error reading event data: %w", err)
+	}
+
+	results, err := HandleEvent(tokens, eventName, eventData)
+	if err != nil {
+		return results, fmt.Errorf("error handling event: %w", err)
+	}
+	return results, nil
+}
+
+// HandleEvent processes a single GitHub event by parsing its payload, authenticating as the
+// installation the event belongs to, and delegating to specific event handlers.
+// The returned results hold the findings the checks recorded while handling the event.
+func HandleEvent(tokens *services.InstallationTokens, eventName string, eventData []byte) (*services.RunResults, error) {
+	results := services.NewRunResults()
+
+	// Skip events the bot does not act on before doing any work
+	if eventName != "issues" && eventName != "pull_request" && eventName != "check_run" && eventName != "issue_comment" {
+		log.Printf("Unhandled event: %s", eventName)
+		return results, nil
 	}
 
 	// Unmarshal the event data into an EventPayload struct
 	var eventPayload models.EventPayload
 	if err := json.Unmarshal(eventData, &eventPayload); err != nil {
-		log.Fatalf("Error parsing event data: %v", err)
+		return results, fmt.Errorf("error parsing event data: %w", err)
 	}
 
-	// Initialize the JAM.AI client and prepare messages for different event types
-	repoLabels := utils.GetLabels(ctx, client, owner, repo)
-	var labels []string
-	for _, label := range repoLabels {
-		if !strings.Contains(*label.Name, "priority") {
-			labels = append(labels, *label.Name)
-		}
+	// Most comments are conversation rather than commands for the bot
+	if eventName == "issue_comment" && commandOf(eventPayload) == "" {
+		log.Println("Comment is not a command, ignoring")
+		return results, nil
+	}
+
+	// Resolve the repository and installation the event was delivered for
+	owner, repo, installationID, err := resolveEventTarget(eventPayload)
+	if err != nil {
+		return results, err
 	}
+	log.Printf("Handling %s event for %s/%s (installation %d)", eventName, owner, repo, installationID)
+
+	// Mint the installation token up front so authentication failures are reported once
+	ts := tokens.TokenSource(installationID)
+	if _, err := ts.Token(); err != nil {
+		return results, fmt.Errorf("error getting installation token for installation %d: %w", installationID, err)
+	}
+
+	// Create a new context that the checks record their findings in, and that masks the secrets found in this event
+	ctx := utils.WithRedactor(services.WithRunResults(context.Background(), results))
+	ctx = services.WithAppID(ctx, tokens.AppID())
+
+	// Initialize the OAuth2 client, the token source refreshes the installation token as it nears expiry
+	tc := oauth2.NewClient(ctx, ts)
+	client := github.NewClient(tc)
+
+	// Resolve the App's own login, so that the checks find the comments they own
+	if login, err := tokens.BotLogin(ctx); err != nil {
+		log.Printf("Error resolving the bot's login, matching comments by marker only: %v", err)
+	} else {
+		ctx = services.WithBotLogin(ctx, login)
+	}
+
+	// Load the repository's configuration from its default branch
+	config := services.LoadRepoConfig(ctx, client, owner, repo)
+	results.SetFailOn(config.Secrets.FailOn)
+
+	// Prepare the LLM provider and messages for different event types
+	repoLabels := utils.GetLabels(ctx, client, owner, repo)
+	labels := services.FilterLabels(repoLabels, config.Labels.Exclude)
 	// Join labels into a single string
 	labelsStr := strings.Join(labels, ", ")
 
-	jamaiClient := services.NewJamaiClient(services.GetJamAiHeader())
-	actionTableId := owner + "_" + repo +"_"+ utils.GetBotVersion()
-	issueResponseMessage := utils.GetColumnMessage("IssueResponse", labelsStr)
-	prResponseMessage := utils.GetColumnMessage("PullReqResponse", labelsStr)
-	prSecretsMessage := utils.GetColumnMessage("PullReqSecretsResponse", labelsStr)
-	secretsJSONMessage := utils.GetColumnMessage("SecretsJSONResponse", labelsStr)
+	actionTableId := owner + "_" + repo + "_" + utils.GetBotVersion()
+	llm, err := services.NewLLMProvider(config, actionTableId)
+	if err != nil {
+		return results, fmt.Errorf("error creating LLM provider: %w", err)
+	}
+	// Account token usage to the repository and enforce its daily budget
+	llm = services.NewMeteredProvider(llm, services.DefaultUsageStore(), owner+"/"+repo, services.DailyBudget(config))
 	// Define the agents and their respective messages
 	agents := []models.Agent{
 		{ColumnID: "IssueBody", Messages: nil},
 		{ColumnID: "PullReqBody", Messages: nil},
 		{ColumnID: "PullReqSecretsBody", Messages: nil},
-		{ColumnID: "IssueResponse", Messages: issueResponseMessage},
-		{ColumnID: "PullReqResponse", Messages: prResponseMessage},
-		{ColumnID: "PullReqSecretsResponse", Messages: prSecretsMessage},
-		{ColumnID: "SecretsJSONResponse", Messages: secretsJSONMessage},
 	}
-	
-	// Create a table in the JAM.AI client with the defined agents
-	services.CreateTable(jamaiClient, models.ActionTable, actionTableId, agents)
+	for _, columnID := range []string{"IssueResponse", "PullReqResponse", "PullReqSecretsResponse", "SecretsJSONResponse"} {
+		agents = append(agents, models.Agent{
+			ColumnID: columnID,
+			Messages: utils.GetColumnMessage(columnID, labelsStr, config.Persona),
+		})
+	}
+
+	// Prepare the LLM provider with the defined agents.
+	// A failure here is not fatal, the checks skip themselves with a notice if the LLM stays unavailable.
+	if err := llm.Setup(ctx, agents); err != nil {
+		log.Printf("Error setting up LLM provider: %v", err)
+	}
 
 	// Handle specific GitHub events
 	switch eventName {
 	case "issues":
-		HandleIssueEvent(ctx, client, jamaiClient, owner, repo, eventPayload)
+		HandleIssueEvent(ctx, client, llm, config, owner, repo, eventPayload)
 	case "pull_request":
-		HandlePullRequestEvent(ctx, client, jamaiClient, owner, repo, eventPayload)
+		HandlePullRequestEvent(ctx, client, llm, config, owner, repo, eventPayload)
+	case "check_run":
+		HandleCheckRunEvent(ctx, client, llm, config, owner, repo, eventPayload)
+	case "issue_comment":
+		HandleIssueCommentEvent(ctx, client, config, owner, repo, eventPayload)
 	default:
 		log.Printf("Unhandled event: %s", eventName)
 	}
+	return results, nil
+}
+
+// resolveEventTarget returns the repository owner, repository name and installation ID of an event.
+// Values in the payload take precedence, the REPO_OWNER, REPO_NAME and TRIAGE_BOT_INSTALLATION_ID
+// environment variables are used for payloads that do not carry them, such as GitHub Actions events.
+func resolveEventTarget(eventPayload models.EventPayload) (string, string, int64, error) {
+	var owner, repo string
+	if eventPayload.Repository != nil {
+		owner = eventPayload.Repository.Owner.Login
+		repo = eventPayload.Repository.Name
+	}
+	if owner == "" {
+		owner = utils.GetRepoOwner("")
+	}
+	if repo == "" {
+		repo = utils.GetRepoName("")
+	}
+	if owner == "" || repo == "" {
+		return "", "", 0, fmt.Errorf("event payload does not name a repository and REPO_OWNER/REPO_NAME are not set")
+	}
+
+	installationID := utils.GetInstallationID()
+	if eventPayload.Installation != nil && eventPayload.Installation.ID != 0 {
+		installationID = eventPayload.Installation.ID
+	}
+	if installationID == 0 {
+		return "", "", 0, fmt.Errorf("event payload does not name an installation and TRIAGE_BOT_INSTALLATION_ID is not set")
+	}
+
+	return owner, repo, installationID, nil
 }
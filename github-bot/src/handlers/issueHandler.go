@@ -2,19 +2,22 @@ package handlers
 
 import (
 	"context"
-	"fmt"
 	"log"
-	"net/http"
 
 	"github.com/google/go-github/v41/github"
 	"github.com/wenjielee1/github-bot/models"
 	"github.com/wenjielee1/github-bot/services"
-	"github.com/wenjielee1/github-bot/utils"
 )
 
 // HandleIssueEvent processes GitHub issue events by extracting issue data from the event payload
 // and delegating the processing to the service layer.
-func HandleIssueEvent(ctx context.Context, client *github.Client, jamaiClient *http.Client, owner, repo string, eventPayload models.EventPayload) {
+func HandleIssueEvent(ctx context.Context, client *github.Client, llm services.LLMProvider, config *models.BotConfig, owner, repo string, eventPayload models.EventPayload) {
+	// Check if issue labelling is enabled for the repository
+	if !config.Checks.IssueLabels {
+		log.Println("Issue labelling is disabled in the repository configuration")
+		return
+	}
+
 	// Check if the issue data is present in the event payload
 	if eventPayload.Issue == nil {
 		log.Println("No issue data found in payload")
@@ -28,5 +31,5 @@ func HandleIssueEvent(ctx context.Context, client *github.Client, jamaiClient *h
 	log.Printf("Processing issue: %s", issue.Title)
 
 	// Delegate the processing of the issue to the services layer
-	services.ProcessIssue(ctx, client, jamaiClient, fmt.Sprintf("%s_%s_%s", owner, repo, utils.GetBotVersion()), owner, repo, issue)
+	services.ProcessIssue(ctx, client, llm, config, owner, repo, issue)
 }
@@ -3,7 +3,6 @@ package handlers
 import (
 	"context"
 	"log"
-	"net/http"
 
 	"github.com/google/go-github/v41/github"
 	"github.com/wenjielee1/github-bot/models"
@@ -12,7 +11,7 @@ import (
 
 // HandlePullRequestEvent processes GitHub pull request events by extracting pull request data from the event payload
 // and delegating various checks and actions to the service layer.
-func HandlePullRequestEvent(ctx context.Context, client *github.Client, jamaiClient *http.Client, owner, repo string, eventPayload models.EventPayload) {
+func HandlePullRequestEvent(ctx context.Context, client *github.Client, llm services.LLMProvider, config *models.BotConfig, owner, repo string, eventPayload models.EventPayload) {
 	// Check if the pull request data is present in the event payload
 	if eventPayload.PullRequest == nil {
 		log.Println("No pull request data found in payload")
@@ -25,14 +24,20 @@ func HandlePullRequestEvent(ctx context.Context, client *github.Client, jamaiCli
 	// Log the pull request number being processed
 	log.Printf("Processing pull request: #%d\n", pr.Number)
 
-	// Cleanup of previous bot comments on a PR synchronize.
-	if eventPayload.Action == "synchronize" {
-		services.DeleteBotComments(ctx, client, jamaiClient, owner, repo, pr, "jambubot")
+	// Delegate the checks enabled in the repository configuration to the services layer.
+	// Secrets are scanned first, so that values they detect are already masked in the changelog suggestions.
+	// On a push, only the commits after the previous head are scanned.
+	if config.Checks.Secrets {
+		before := ""
+		if eventPayload.Action == "synchronize" {
+			before = eventPayload.Before
+			log.Printf("PR #%d pushed from %s to %s", pr.Number, eventPayload.Before, eventPayload.After)
+		}
+		services.CheckSecretKeyLeakage(ctx, client, llm, config, owner, repo, pr, before)
+	}
+	if config.Checks.Changelog {
+		services.CheckChangelogUpdated(ctx, client, llm, config, owner, repo, pr)
 	}
-
-	// Delegate various checks and actions to the services layer
-	services.CheckChangelogUpdated(ctx, client, jamaiClient, owner, repo, pr)
-	services.CheckSecretKeyLeakage(ctx, client, jamaiClient, owner, repo, pr)
 
 	// services.SuggestLabelsForPR(ctx, client, owner, repo, pr)
 }
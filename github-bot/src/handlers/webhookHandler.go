@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/wenjielee1/github-bot/services"
+	"github.com/wenjielee1/github-bot/utils"
+)
+
+// maxPayloadSize is the largest webhook payload GitHub will deliver (25 MB).
+const maxPayloadSize = 25 << 20
+
+// WebhookHandler receives GitHub App webhook deliveries over HTTP, verifies their signatures
+// and dispatches them to the same event handlers used by the GitHub Actions workflow.
+type WebhookHandler struct {
+	Secret string                       // The webhook secret configured on the GitHub App.
+	Tokens *services.InstallationTokens // Installation tokens for every installation of the GitHub App.
+}
+
+// ServeHTTP verifies a single webhook delivery and processes it in the background,
+// so that GitHub receives a response well within its delivery timeout.
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Read the raw payload, the signature is computed over the exact bytes GitHub sent
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+	if err != nil {
+		log.Printf("Error reading webhook payload: %v", err)
+		http.Error(w, "error reading payload", http.StatusBadRequest)
+		return
+	}
+
+	deliveryID := r.Header.Get("X-GitHub-Delivery")
+	if err := utils.VerifyWebhookSignature(payload, r.Header.Get("X-Hub-Signature-256"), h.Secret); err != nil {
+		log.Printf("Rejecting delivery %s: %v", deliveryID, err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	eventName := r.Header.Get("X-GitHub-Event")
+	log.Printf("Received delivery %s for event %s", deliveryID, eventName)
+
+	// GitHub sends a ping when the webhook is first configured, there is nothing to process
+	if eventName == "ping" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+
+	go func() {
+		// A panic in one delivery must not take down the server and every other delivery with it
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				log.Printf("Panic handling delivery %s: %v\n%s", deliveryID, recovered, debug.Stack())
+			}
+		}()
+		if _, err := HandleEvent(h.Tokens, eventName, payload); err != nil {
+			log.Printf("Error handling delivery %s: %v", deliveryID, err)
+		}
+	}()
+}
@@ -0,0 +1,68 @@
+package models
+
+// BotConfig defines the per-repository configuration loaded from .github/jambubot.yml.
+// Any field left out of the file keeps its default value.
+type BotConfig struct {
+	Checks    ChecksConfig    `yaml:"checks"`    // Which checks the bot runs.
+	Models    ModelsConfig    `yaml:"models"`    // Which models the bot generates responses with.
+	Labels    LabelsConfig    `yaml:"labels"`    // Which labels the bot considers.
+	Persona   PersonaConfig   `yaml:"persona"`   // How the bot presents itself.
+	LLM       LLMConfig       `yaml:"llm"`       // Which LLM backend generates the responses.
+	Budget    BudgetConfig    `yaml:"budget"`    // How many tokens the bot may spend on the repository.
+	Secrets   SecretsConfig   `yaml:"secrets"`   // How secret findings are reported.
+	Diff      DiffConfig      `yaml:"diff"`      // Which changes are sent to the LLM.
+	Changelog ChangelogConfig `yaml:"changelog"` // Where the changelog of the repository is.
+}
+
+// ChecksConfig defines which checks are enabled for a repository.
+type ChecksConfig struct {
+	IssueLabels bool `yaml:"issue_labels"` // Whether new issues are labelled.
+	Changelog   bool `yaml:"changelog"`    // Whether pull requests are checked for CHANGELOG.md updates.
+	Secrets     bool `yaml:"secrets"`      // Whether pull request commits are scanned for leaked secrets.
+}
+
+// ChangelogConfig defines the changelog the changelog check looks for.
+type ChangelogConfig struct {
+	Path string `yaml:"path"` // The path of the changelog, e.g. "services/api/CHANGELOG.md" in a monorepo.
+}
+
+// DiffConfig defines which changed files are left out of what is sent to the LLM, on top of the built-in
+// lockfile, vendored, generated and binary paths and the linguist-generated files of .gitattributes.
+type DiffConfig struct {
+	Exclude      []string `yaml:"exclude"`        // Path globs of further files that are never sent.
+	Include      []string `yaml:"include"`        // Path globs of files that are sent even if a built-in path matches them.
+	MaxFileBytes int      `yaml:"max_file_bytes"` // The largest patch sent per file, longer ones are truncated. 0 for no cap.
+}
+
+// ModelsConfig defines the models used by the bot.
+// Empty values fall back to the operator's defaults from the environment.
+type ModelsConfig struct {
+	Default   string                  `yaml:"default"`   // The model used by every check without its own model.
+	Issue     string                  `yaml:"issue"`     // The model used to label issues.
+	Changelog string                  `yaml:"changelog"` // The model used to suggest changelog entries.
+	Secrets   string                  `yaml:"secrets"`   // The model used to scan for leaked secrets.
+	Embedding string                  `yaml:"embedding"` // The embedding model used for knowledge tables.
+	Columns   map[string]ColumnConfig `yaml:"columns"`   // Generation settings per output column, e.g. "IssueResponse".
+}
+
+// ColumnConfig defines the generation settings of a single output column.
+// Unset values fall back to the settings of the check that owns the column.
+type ColumnConfig struct {
+	Model       string   `yaml:"model"`       // The model used for generation.
+	Temperature *float64 `yaml:"temperature"` // The temperature setting for generation.
+	MaxTokens   int      `yaml:"max_tokens"`  // The maximum number of tokens for the generated response.
+	TopP        *float64 `yaml:"top_p"`       // The nucleus sampling parameter.
+}
+
+// LabelsConfig defines how repository labels are filtered.
+type LabelsConfig struct {
+	Exclude       []string `yaml:"exclude"`         // Labels containing any of these strings are never suggested.
+	SkipIfPresent []string `yaml:"skip_if_present"` // Issues already carrying a label containing any of these strings are left alone.
+}
+
+// PersonaConfig defines how the bot presents itself in its responses.
+type PersonaConfig struct {
+	Name         string `yaml:"name"`         // The name the bot introduces itself with.
+	Greeting     bool   `yaml:"greeting"`     // Whether responses start with a pun on the bot's name.
+	Instructions string `yaml:"instructions"` // Extra instructions appended to every system prompt.
+}
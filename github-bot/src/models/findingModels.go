@@ -0,0 +1,21 @@
+package models
+
+// Finding is a problem a check found at a location in the repository, in a form shared by every check
+// so that it can be exported, for example as SARIF.
+type Finding struct {
+	Check       string // The check that produced the finding, e.g. "secrets".
+	RuleID      string // The stable ID of the rule that matched.
+	Severity    string // One of SeverityHigh, SeverityMedium or SeverityLow.
+	Message     string // A description of the finding, free of secret values.
+	File        string // The path of the file, relative to the repository root.
+	Line        int    // The line number in the file, 0 if the finding is not tied to a line.
+	Fingerprint string // A stable identifier of the finding across runs.
+}
+
+// FindingRule describes a rule findings can be reported for.
+type FindingRule struct {
+	ID          string // The stable ID of the rule.
+	Name        string // A short name of the rule.
+	Description string // A human readable description of what the rule detects.
+	Severity    string // The default severity of the rule's findings.
+}
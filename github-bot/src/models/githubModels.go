@@ -1,11 +1,31 @@
 package models
 
 // EventPayload represents the payload of a GitHub event.
-// It contains the action performed and optional pull request and issue data.
+// It contains the action performed, optional pull request, issue, comment and check run data,
+// and the repository and GitHub App installation the event was delivered for.
 type EventPayload struct {
-	Action      string       `json:"action"`       // The action that triggered the event (e.g., "opened", "closed").
-	PullRequest *PullRequest `json:"pull_request"` // Pull request data, if applicable.
-	Issue       *Issue       `json:"issue"`        // Issue data, if applicable.
+	Action       string        `json:"action"`       // The action that triggered the event (e.g., "opened", "closed").
+	Before       string        `json:"before"`       // The head SHA before a pull request push, on "synchronize".
+	After        string        `json:"after"`        // The head SHA after a pull request push, on "synchronize".
+	PullRequest  *PullRequest  `json:"pull_request"` // Pull request data, if applicable.
+	Issue        *Issue        `json:"issue"`        // Issue data, if applicable.
+	Comment      *Comment      `json:"comment"`      // Comment data, on "issue_comment" events.
+	CheckRun     *CheckRun     `json:"check_run"`    // Check run data, if applicable.
+	Repository   *Repository   `json:"repository"`   // The repository the event occurred in.
+	Installation *Installation `json:"installation"` // The GitHub App installation, present on App webhook deliveries.
+}
+
+// Repository represents the repository a GitHub event occurred in.
+type Repository struct {
+	Name  string `json:"name"` // The name of the repository.
+	Owner struct {
+		Login string `json:"login"` // The login of the user or organization owning the repository.
+	} `json:"owner"`
+}
+
+// Installation represents the GitHub App installation an event was delivered for.
+type Installation struct {
+	ID int64 `json:"id"` // The ID of the installation.
 }
 
 // PullRequest represents the details of a GitHub pull request.
@@ -13,6 +33,26 @@ type PullRequest struct {
 	Number       int    `json:"number"`        // The number of the pull request.
 	ChangedFiles int    `json:"changed_files"` // The number of files changed in the pull request.
 	DiffURL      string `json:"diff_url"`      // The URL to view the diff of the pull request.
+	Head         struct {
+		SHA string `json:"sha"` // The SHA of the latest commit on the head branch.
+		Ref string `json:"ref"` // The name of the head branch.
+	} `json:"head"` // The branch the pull request merges from.
+	Base struct {
+		SHA string `json:"sha"` // The SHA of the commit on the base branch the pull request was last compared to.
+		Ref string `json:"ref"` // The name of the base branch.
+	} `json:"base"` // The branch the pull request merges into.
+}
+
+// CheckRun represents the details of a GitHub check run.
+type CheckRun struct {
+	Name         string `json:"name"`     // The name of the check run.
+	HeadSHA      string `json:"head_sha"` // The SHA of the commit the check run belongs to.
+	PullRequests []struct {
+		Number int `json:"number"` // The number of the pull request.
+	} `json:"pull_requests"` // The pull requests of the commit, empty for pull requests from forks.
+	App struct {
+		ID int64 `json:"id"` // The ID of the App that created the check run.
+	} `json:"app"` // The App that created the check run.
 }
 
 // Issue represents the details of a GitHub issue.
@@ -21,4 +61,23 @@ type Issue struct {
 	Body   string `json:"body"`   // The body content of the issue.
 	Title  string `json:"title"`  // The title of the issue.
 	State  string `json:"state"`  // The state of the issue (e.g., "open", "closed").
+	User   User   `json:"user"`   // The user who opened the issue.
+	// PullRequest is present if the issue is a pull request, as comments on pull requests are issue comments.
+	PullRequest *struct {
+		URL string `json:"url"` // The API URL of the pull request.
+	} `json:"pull_request"`
+}
+
+// Comment represents the details of a comment on an issue or pull request.
+type Comment struct {
+	ID                int64  `json:"id"`                 // The ID of the comment.
+	Body              string `json:"body"`               // The body content of the comment.
+	User              User   `json:"user"`               // The user who wrote the comment.
+	AuthorAssociation string `json:"author_association"` // The author's relationship to the repository (e.g., "MEMBER").
+}
+
+// User represents a GitHub user or bot.
+type User struct {
+	Login string `json:"login"` // The login of the user.
+	Type  string `json:"type"`  // "User", "Bot" or "Organization".
 }
@@ -1,5 +1,7 @@
 package models
 
+import "encoding/json"
+
 // TableType defines a type for different kinds of tables used in the system.
 type TableType string
 
@@ -44,7 +46,7 @@ type Col struct {
 
 // CreateAgentChatTableRequest defines the request structure for creating an agent chat table.
 type CreateAgentChatTableRequest struct {
-	ID   string `json:"id"`  // The ID of the table to be created.
+	ID   string `json:"id"`   // The ID of the table to be created.
 	Cols []Col  `json:"cols"` // The columns of the table.
 }
 
@@ -69,8 +71,8 @@ type CreateAgentConversationTableRequest struct {
 
 // CreateAgentKnowledgeTableRequest defines the request structure for creating an agent knowledge table.
 type CreateAgentKnowledgeTableRequest struct {
-	ID             string `json:"id"`             // The ID of the table to be created.
-	Cols           []Col  `json:"cols"`           // The columns of the table.
+	ID             string `json:"id"`              // The ID of the table to be created.
+	Cols           []Col  `json:"cols"`            // The columns of the table.
 	EmbeddingModel string `json:"embedding_model"` // The embedding model to be used.
 }
 
@@ -89,7 +91,7 @@ type JamaiAuth struct {
 
 // CreateIssueResponse defines the structure of the response when creating an issue.
 type CreateIssueResponse struct {
-	Labels   []string `json:"labels"` // The labels assigned to the issue.
+	Labels   []string `json:"labels"`   // The labels assigned to the issue.
 	Priority string   `json:"priority"` // The priority of the issue.
 	Response string   `json:"response"` // The response message for the issue.
 }
@@ -97,11 +99,11 @@ type CreateIssueResponse struct {
 // Choice defines the structure of a choice in the response.
 type Choice struct {
 	Message struct {
-		Role    string  `json:"role"`    // The role of the message sender.
-		Content string  `json:"content"` // The content of the message.
+		Role    string  `json:"role"`           // The role of the message sender.
+		Content string  `json:"content"`        // The content of the message.
 		Name    *string `json:"name,omitempty"` // The name of the sender, if applicable.
 	} `json:"message"`
-	Index        int         `json:"index"`        // The index of the choice.
+	Index        int         `json:"index"`         // The index of the choice.
 	FinishReason interface{} `json:"finish_reason"` // The reason the choice finished.
 }
 
@@ -114,20 +116,38 @@ type Usage struct {
 
 // StreamResponse defines the structure of a streaming response.
 type StreamResponse struct {
-	ID               string   `json:"id"`                // The ID of the response.
-	Object           string   `json:"object"`            // The object type.
-	Created          int64    `json:"created"`           // The creation timestamp.
-	Model            string   `json:"model"`             // The model used for generation.
-	Usage            Usage    `json:"usage"`             // The usage details of the response.
-	Choices          []Choice `json:"choices"`           // The choices in the response.
-	References       *string  `json:"references,omitempty"` // The references, if any.
-	OutputColumnName string   `json:"output_column_name"` // The name of the output column.
-	RowID            string   `json:"row_id"`            // The ID of the row.
+	ID               string          `json:"id"`                   // The ID of the response.
+	Object           string          `json:"object"`               // The object type.
+	Created          int64           `json:"created"`              // The creation timestamp.
+	Model            string          `json:"model"`                // The model used for generation.
+	Usage            *Usage          `json:"usage,omitempty"`      // The usage details of the response, usually only on the final chunk.
+	Choices          []Choice        `json:"choices"`              // The choices in the response.
+	References       json.RawMessage `json:"references,omitempty"` // The references retrieved for the response, if any.
+	OutputColumnName string          `json:"output_column_name"`   // The name of the output column.
+	RowID            string          `json:"row_id"`               // The ID of the row.
+	Error            json.RawMessage `json:"error,omitempty"`      // The error reported by the server, if any.
+	Detail           json.RawMessage `json:"detail,omitempty"`     // The error detail reported by the server, if any.
+}
+
+// ColumnResult defines everything streamed for a single output column of a row.
+type ColumnResult struct {
+	Content    string          // The concatenated content of the column.
+	Usage      Usage           // The token usage of generating the column.
+	References json.RawMessage // The references retrieved for the column, if any.
 }
 
 // CreatePullReqSecretResponse defines the structure of the response when checking for secret key leakage in a pull request.
 type CreatePullReqSecretResponse struct {
-	Leak   bool   `json:"leak"`   // Whether a leak was detected.
-	Commit string `json:"commit"` // The commit hash.
-	Response string `json:"response"` // The response message.
+	Leak       bool                     `json:"leak"`       // Whether a leak was detected.
+	Commit     string                   `json:"commit"`     // The commit hash.
+	Response   string                   `json:"response"`   // The response message.
+	Candidates []SecretCandidateVerdict `json:"candidates"` // The verdict on each candidate flagged by the scanner.
+}
+
+// SecretCandidateVerdict is the LLM's verdict on one candidate flagged by the secret scanner.
+type SecretCandidateVerdict struct {
+	File   string `json:"file"`   // The path of the file the candidate is in.
+	Line   int    `json:"line"`   // The line of the candidate in the new version of the file.
+	Leak   bool   `json:"leak"`   // Whether the candidate is a real secret.
+	Reason string `json:"reason"` // Why the candidate is or is not a real secret.
 }
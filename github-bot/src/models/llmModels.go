@@ -0,0 +1,27 @@
+package models
+
+// LLMConfig defines which LLM backend a repository's checks are generated with.
+// The endpoint and API key of the OpenAI-compatible backend are configured by the operator through
+// environment variables, so that repository configuration can never redirect credentials elsewhere.
+type LLMConfig struct {
+	Provider string `yaml:"provider"` // The backend to use, "jamai" (default) or "openai".
+	Model    string `yaml:"model"`    // The model requested from the OpenAI-compatible backend.
+}
+
+// ChatCompletionRequest defines the request structure of an OpenAI-compatible chat completion.
+type ChatCompletionRequest struct {
+	Model       string    `json:"model"`                // The model used for generation.
+	Messages    []Message `json:"messages"`             // The conversation to complete.
+	Temperature float64   `json:"temperature"`          // The temperature setting for generation.
+	MaxTokens   int       `json:"max_tokens,omitempty"` // The maximum number of tokens for the generated response.
+	TopP        float64   `json:"top_p"`                // The nucleus sampling parameter.
+	Stream      bool      `json:"stream"`               // Whether to stream the response.
+}
+
+// ChatCompletionResponse defines the response structure of an OpenAI-compatible chat completion.
+type ChatCompletionResponse struct {
+	ID      string   `json:"id"`      // The ID of the completion.
+	Model   string   `json:"model"`   // The model used for generation.
+	Choices []Choice `json:"choices"` // The generated choices.
+	Usage   Usage    `json:"usage"`   // The token usage of the completion.
+}
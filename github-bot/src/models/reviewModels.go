@@ -0,0 +1,9 @@
+package models
+
+// ReviewComment is an inline comment on a line, or a range of lines, of the new version of a file in a pull request.
+type ReviewComment struct {
+	File      string // The path of the file.
+	StartLine int    // The first line of a multi-line comment, 0 for a comment on a single line.
+	Line      int    // The line number in the new version of the file, the last line of a multi-line comment.
+	Body      string // The markdown body of the comment.
+}
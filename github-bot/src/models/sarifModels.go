@@ -0,0 +1,78 @@
+package models
+
+// SarifLog is the top-level object of a SARIF 2.1.0 file.
+type SarifLog struct {
+	Schema  string     `json:"$schema"` // The URI of the SARIF JSON schema.
+	Version string     `json:"version"` // The SARIF version, always "2.1.0".
+	Runs    []SarifRun `json:"runs"`    // The runs of analysis tools in the file.
+}
+
+// SarifRun is the result of a single run of an analysis tool.
+type SarifRun struct {
+	Tool    SarifTool     `json:"tool"`    // The tool that produced the results.
+	Results []SarifResult `json:"results"` // The results of the run, empty if nothing was found.
+}
+
+// SarifTool describes the analysis tool.
+type SarifTool struct {
+	Driver SarifDriver `json:"driver"` // The main component of the tool.
+}
+
+// SarifDriver describes the tool's main component and the rules it applies.
+type SarifDriver struct {
+	Name           string                     `json:"name"`                     // The name of the tool.
+	Version        string                     `json:"version,omitempty"`        // The version of the tool.
+	InformationURI string                     `json:"informationUri,omitempty"` // Where to learn more about the tool.
+	Rules          []SarifReportingDescriptor `json:"rules"`                    // The rules results refer to.
+}
+
+// SarifReportingDescriptor describes a rule.
+type SarifReportingDescriptor struct {
+	ID                   string                 `json:"id"`                   // The stable ID of the rule.
+	Name                 string                 `json:"name,omitempty"`       // A short name of the rule.
+	ShortDescription     SarifMessage           `json:"shortDescription"`     // What the rule detects.
+	DefaultConfiguration SarifRuleConfiguration `json:"defaultConfiguration"` // The default level of the rule.
+	Properties           map[string]interface{} `json:"properties,omitempty"` // Additional properties, e.g. GitHub's security-severity.
+}
+
+// SarifRuleConfiguration holds the default level of a rule.
+type SarifRuleConfiguration struct {
+	Level string `json:"level"` // "error", "warning" or "note".
+}
+
+// SarifMessage is a plain text message.
+type SarifMessage struct {
+	Text string `json:"text"` // The text of the message.
+}
+
+// SarifResult is a single finding.
+type SarifResult struct {
+	RuleID              string            `json:"ruleId"`                        // The ID of the rule that matched.
+	RuleIndex           int               `json:"ruleIndex"`                     // The index of the rule in the driver's rules.
+	Level               string            `json:"level"`                         // "error", "warning" or "note".
+	Message             SarifMessage      `json:"message"`                       // The description of the finding.
+	Locations           []SarifLocation   `json:"locations"`                     // Where the finding is.
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"` // Stable identifiers used to track the finding across runs.
+}
+
+// SarifLocation is the location of a result.
+type SarifLocation struct {
+	PhysicalLocation SarifPhysicalLocation `json:"physicalLocation"` // The file and region of the result.
+}
+
+// SarifPhysicalLocation is a region of a file.
+type SarifPhysicalLocation struct {
+	ArtifactLocation SarifArtifactLocation `json:"artifactLocation"` // The file.
+	Region           *SarifRegion          `json:"region,omitempty"` // The lines, if the result is tied to any.
+}
+
+// SarifArtifactLocation is a file relative to the repository root.
+type SarifArtifactLocation struct {
+	URI       string `json:"uri"`                 // The path of the file.
+	URIBaseID string `json:"uriBaseId,omitempty"` // The base the path is relative to.
+}
+
+// SarifRegion is a range of lines.
+type SarifRegion struct {
+	StartLine int `json:"startLine"` // The first line, starting at 1.
+}
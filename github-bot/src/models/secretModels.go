@@ -0,0 +1,50 @@
+package models
+
+// Severity levels of secret findings, from most to least severe.
+const (
+	SeverityHigh   = "high"
+	SeverityMedium = "medium"
+	SeverityLow    = "low"
+)
+
+// SecretFinding is a suspected secret on an added line of a commit.
+type SecretFinding struct {
+	RuleID      string  `json:"rule_id"`               // The stable ID of the rule that matched, e.g. "aws-access-key-id".
+	Description string  `json:"description"`           // A human readable description of the rule.
+	Severity    string  `json:"severity"`              // One of SeverityHigh, SeverityMedium or SeverityLow.
+	Commit      string  `json:"commit"`                // The SHA of the commit that added the line.
+	File        string  `json:"file"`                  // The path of the file.
+	Line        int     `json:"line"`                  // The line number in the new version of the file.
+	Match       string  `json:"-"`                     // The matched value. Never written to comments or logs unmasked.
+	Fingerprint string  `json:"fingerprint"`           // The fingerprint of the finding, as used in the secrets baseline.
+	Entropy     float64 `json:"entropy"`               // The Shannon entropy of the matched value in bits per character.
+	Confirmed   bool    `json:"confirmed"`             // Whether a rule matched, or the LLM confirmed an ambiguous candidate.
+	Explanation string  `json:"explanation,omitempty"` // The LLM's explanation of a confirmed candidate, if any.
+}
+
+// SecretReport is the set of secret findings of a pull request that is sent to the secret notifiers.
+type SecretReport struct {
+	Owner       string          `json:"owner"`        // The owner of the repository.
+	Repo        string          `json:"repo"`         // The name of the repository.
+	PullRequest int             `json:"pull_request"` // The number of the pull request.
+	HeadSHA     string          `json:"head_sha"`     // The SHA of the head of the pull request.
+	Findings    []SecretFinding `json:"findings"`     // The findings of all commits of the pull request.
+}
+
+// SecretsConfig defines how secret findings of a repository are reported.
+type SecretsConfig struct {
+	Notifiers []string `yaml:"notifiers"` // The notifiers the findings are sent to: "check_run", "webhook", "advisory", "comment" or "review".
+	FailOn    string   `yaml:"fail_on"`   // The lowest severity that fails the GitHub Actions run: "high", "medium", "low" or "none".
+}
+
+// SecretsBaseline lists secret findings a repository has accepted, such as fake keys in test fixtures.
+type SecretsBaseline struct {
+	Fingerprints map[string]string // Accepted finding fingerprints, mapped to the comment recorded with them.
+	Paths        []string          // Path globs whose findings are all accepted.
+}
+
+// SecretScanState records which commits of a pull request have been scanned for secrets, so that later pushes
+// do not send their candidates to the LLM again. Findings are not stored, the rules find them again.
+type SecretScanState struct {
+	Commits []string `json:"commits"` // The SHAs of the commits that were scanned completely without an LLM-confirmed finding.
+}
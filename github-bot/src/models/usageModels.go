@@ -0,0 +1,20 @@
+package models
+
+// BudgetConfig defines the token budget of a repository.
+type BudgetConfig struct {
+	DailyTokens int `yaml:"daily_tokens"` // The total tokens the repository may use per UTC day, 0 for no cap.
+}
+
+// UsageRecord defines the accumulated token usage of one check in one repository on one day.
+type UsageRecord struct {
+	Requests         int `json:"requests"`          // The number of generated columns.
+	PromptTokens     int `json:"prompt_tokens"`     // The number of tokens in the prompts.
+	CompletionTokens int `json:"completion_tokens"` // The number of tokens in the completions.
+	TotalTokens      int `json:"total_tokens"`      // The total number of tokens used.
+}
+
+// UsageLedger defines the content of the local usage store.
+type UsageLedger struct {
+	Usage   map[string]map[string]map[string]*UsageRecord `json:"usage"`   // Usage keyed by repository, then day (YYYY-MM-DD), then check.
+	Notices map[string]bool                               `json:"notices"` // Budget notices already posted, keyed by repository, number and day.
+}
@@ -2,53 +2,232 @@ package services
 
 import (
 	"context"
+	"crypto/rsa"
+	"fmt"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/google/go-github/v41/github"
 	"github.com/wenjielee1/github-bot/models"
+	"github.com/wenjielee1/github-bot/utils"
 	"golang.org/x/oauth2"
 )
 
-// GetInstallationToken retrieves an installation token for the GitHub App.
-// It uses the provided installation ID and JWT token to authenticate.
-func GetInstallationToken(installationID int64, jwtToken string) (string, error) {
-	// Create a new context
-	ctx := context.Background()
+// defaultGitHubBaseURL is the GitHub REST API endpoint installation tokens are minted from.
+const defaultGitHubBaseURL = "https://api.github.com/"
 
-	// Initialize the OAuth2 token source and client
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: jwtToken},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
+// tokenRefreshMargin is how long before expiry an installation token is re-minted,
+// so that requests in flight never carry a token that expires mid-way.
+const tokenRefreshMargin = 5 * time.Minute
 
-	// Create an installation token using the GitHub client
-	token, _, err := client.Apps.CreateInstallationToken(ctx, installationID, nil)
+// defaultTokenLifetime is assumed when GitHub does not report an expiry for an installation token.
+const defaultTokenLifetime = time.Hour
+
+// InstallationTokenSource is an oauth2.TokenSource for a single installation of the GitHub App.
+// It re-signs the App JWT and re-mints the installation token whenever the cached token is about to expire,
+// and is safe for concurrent use.
+type InstallationTokenSource struct {
+	appID          int64
+	installationID int64
+	privateKey     *rsa.PrivateKey
+	baseURL        string
+	httpClient     *http.Client
+	clock          func() time.Time
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// Token returns the cached installation token, minting a new one if it is missing or about to expire.
+func (s *InstallationTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock()
+	if s.token != nil && now.Add(tokenRefreshMargin).Before(s.token.Expiry) {
+		return s.token, nil
+	}
+
+	token, err := s.mint(now)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Minted installation token for installation %d, expires at %s", s.installationID, token.Expiry.Format(time.RFC3339))
+	s.token = token
+	return token, nil
+}
+
+// mint signs a fresh App JWT and exchanges it for a new installation token.
+func (s *InstallationTokenSource) mint(now time.Time) (*oauth2.Token, error) {
+	appClient, err := newAppClient(s.appID, s.privateKey, s.baseURL, s.httpClient, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// Retrieve the installation token using the JWT token.
+	// The installation token is used to authenticate API requests for a specific installation of the GitHub App.
+	installationToken, _, err := appClient.Apps.CreateInstallationToken(context.Background(), s.installationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating installation token for installation %d: %w", s.installationID, err)
+	}
+
+	expiry := now.Add(defaultTokenLifetime)
+	if installationToken.ExpiresAt != nil {
+		expiry = *installationToken.ExpiresAt
+	}
+	return &oauth2.Token{
+		AccessToken: installationToken.GetToken(),
+		TokenType:   "token",
+		Expiry:      expiry,
+	}, nil
+}
+
+// InstallationTokens hands out a cached InstallationTokenSource for every installation of the GitHub App,
+// so that a single deployment can serve events from any repository the App is installed on.
+// BaseURL, HTTPClient and Clock may be overridden before the first call to TokenSource,
+// which lets tests point the sources at a local fake of the GitHub API and control time.
+type InstallationTokens struct {
+	BaseURL    string           // The GitHub REST API base URL. Defaults to https://api.github.com/.
+	HTTPClient *http.Client     // The HTTP client used to mint tokens. Defaults to http.DefaultClient.
+	Clock      func() time.Time // The clock used to sign JWTs and check expiry. Defaults to time.Now.
+
+	appID      int64
+	privateKey *rsa.PrivateKey
+
+	mu       sync.Mutex
+	sources  map[int64]*InstallationTokenSource
+	botLogin string // The App's login, looked up on first use.
+}
+
+// AppID returns the ID of the GitHub App.
+func (t *InstallationTokens) AppID() int64 {
+	return t.appID
+}
+
+// NewInstallationTokens creates an installation token cache for the GitHub App with the given ID and private key.
+func NewInstallationTokens(appID int64, privateKey *rsa.PrivateKey) *InstallationTokens {
+	return &InstallationTokens{
+		BaseURL:    defaultGitHubBaseURL,
+		HTTPClient: http.DefaultClient,
+		Clock:      time.Now,
+		appID:      appID,
+		privateKey: privateKey,
+		sources:    make(map[int64]*InstallationTokenSource),
+	}
+}
+
+// TokenSource returns the token source for the given installation ID, creating it on first use.
+// The same source is returned for every call with the same installation ID, so tokens are shared across events.
+func (t *InstallationTokens) TokenSource(installationID int64) oauth2.TokenSource {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if source, ok := t.sources[installationID]; ok {
+		return source
+	}
+	source := &InstallationTokenSource{
+		appID:          t.appID,
+		installationID: installationID,
+		privateKey:     t.privateKey,
+		baseURL:        t.BaseURL,
+		httpClient:     t.HTTPClient,
+		clock:          t.Clock,
+	}
+	t.sources[installationID] = source
+	return source
+}
+
+// newAppClient creates a GitHub client authenticated as the App itself with a JWT signed at now.
+func newAppClient(appID int64, privateKey *rsa.PrivateKey, gitHubBaseURL string, httpClient *http.Client, now time.Time) (*github.Client, error) {
+	// Generate a JWT token for authentication.
+	// The JWT token is used to authenticate as the GitHub App and is required to perform actions on behalf of the app.
+	jwtToken, err := utils.GenerateJWTAt(appID, privateKey, now)
+	if err != nil {
+		return nil, fmt.Errorf("error generating JWT: %w", err)
+	}
+
+	// Authenticate as the App using the JWT token on top of the configured HTTP client
+	appClient := github.NewClient(&http.Client{
+		Transport: &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: jwtToken}),
+			Base:   httpClient.Transport,
+		},
+		Timeout: httpClient.Timeout,
+	})
+	baseURL, err := url.Parse(gitHubBaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing GitHub base URL %q: %w", gitHubBaseURL, err)
+	}
+	appClient.BaseURL = baseURL
+	return appClient, nil
+}
+
+// AppClient returns a GitHub client authenticated as the App itself, for the endpoints under /app.
+func (t *InstallationTokens) AppClient() (*github.Client, error) {
+	return newAppClient(t.appID, t.privateKey, t.BaseURL, t.HTTPClient, t.Clock())
+}
+
+// RepositoryInstallation looks up the ID of the App's installation on a repository.
+func (t *InstallationTokens) RepositoryInstallation(ctx context.Context, owner, repo string) (int64, error) {
+	appClient, err := t.AppClient()
+	if err != nil {
+		return 0, err
+	}
+	installation, _, err := appClient.Apps.FindRepositoryInstallation(ctx, owner, repo)
+	if err != nil {
+		return 0, fmt.Errorf("error finding installation on %s/%s: %w", owner, repo, err)
+	}
+	return installation.GetID(), nil
+}
+
+// BotLogin returns the login the App comments as, its slug followed by "[bot]".
+// The slug is looked up from the App API on first use.
+func (t *InstallationTokens) BotLogin(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	login := t.botLogin
+	t.mu.Unlock()
+	if login != "" {
+		return login, nil
+	}
+
+	appClient, err := t.AppClient()
 	if err != nil {
 		return "", err
 	}
-	return token.GetToken(), nil
+	app, _, err := appClient.Apps.Get(ctx, "")
+	if err != nil {
+		return "", fmt.Errorf("error getting the App: %w", err)
+	}
+	login = app.GetSlug() + "[bot]"
+
+	t.mu.Lock()
+	t.botLogin = login
+	t.mu.Unlock()
+	return login, nil
 }
 
 // GetJamAiHeader retrieves the JAM.AI authentication header.
 // It fetches the JAM.AI key and project ID from environment variables.
-func GetJamAiHeader() *models.JamaiAuth {
+func GetJamAiHeader() (*models.JamaiAuth, error) {
 	// Retrieve the JAM.AI key from environment variables
 	jamaiKey := os.Getenv("TRIAGE_BOT_JAMAI_KEY")
 	if jamaiKey == "" {
-		log.Fatalf("Error: JAMAI_KEY environment variable not set")
+		return nil, fmt.Errorf("TRIAGE_BOT_JAMAI_KEY environment variable not set")
 	}
 
 	// Retrieve the JAM.AI project ID from environment variables
 	projectId := os.Getenv("TRIAGE_BOT_JAMAI_PROJECT_ID")
 	if projectId == "" {
-		log.Fatalf("Error: JAMAI_PROJECT_ID environment variable not set")
+		return nil, fmt.Errorf("TRIAGE_BOT_JAMAI_PROJECT_ID environment variable not set")
 	}
 
 	// Return the JAM.AI authentication header
 	return &models.JamaiAuth{
 		Authorization: "Bearer " + jamaiKey,
 		XProjectID:    projectId,
-	}
+	}, nil
 }
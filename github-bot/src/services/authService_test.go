@@ -0,0 +1,105 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTokenEndpoint serves /app/installations/{id}/access_tokens, minting numbered tokens that expire an hour
+// after the current time of the test's clock.
+type fakeTokenEndpoint struct {
+	mu     sync.Mutex
+	minted int
+	now    func() time.Time
+}
+
+func (f *fakeTokenEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/app/installations/42/access_tokens" {
+		http.NotFound(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		http.Error(w, "missing JWT", http.StatusUnauthorized)
+		return
+	}
+	f.mu.Lock()
+	f.minted++
+	minted := f.minted
+	f.mu.Unlock()
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, `{"token":"token-%d","expires_at":%q}`, minted, f.now().Add(time.Hour).UTC().Format(time.RFC3339))
+}
+
+func TestInstallationTokenSourceCachesAndRefreshes(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	endpoint := &fakeTokenEndpoint{now: clock}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	tokens := NewInstallationTokens(1, privateKey)
+	tokens.BaseURL = server.URL + "/"
+	tokens.HTTPClient = server.Client()
+	tokens.Clock = clock
+	source := tokens.TokenSource(42)
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		want    string
+		minted  int
+	}{
+		{"first call mints", 0, "token-1", 1},
+		{"cached while fresh", 30 * time.Minute, "token-1", 1},
+		{"cached until the refresh margin", 54 * time.Minute, "token-1", 1},
+		{"refreshed within the margin", 56 * time.Minute, "token-2", 2},
+		{"new token is cached", 57 * time.Minute, "token-2", 2},
+	}
+	start := now
+	for _, step := range steps {
+		now = start.Add(step.advance)
+		token, err := source.Token()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if token.AccessToken != step.want {
+			t.Errorf("%s: got token %q, want %q", step.name, token.AccessToken, step.want)
+		}
+		if endpoint.minted != step.minted {
+			t.Errorf("%s: minted %d tokens, want %d", step.name, endpoint.minted, step.minted)
+		}
+	}
+
+	if tokens.TokenSource(42) != source {
+		t.Errorf("TokenSource returned a new source for the same installation")
+	}
+}
+
+func TestInstallationTokenSourceReportsErrors(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	tokens := NewInstallationTokens(1, privateKey)
+	tokens.BaseURL = server.URL + "/"
+	tokens.HTTPClient = server.Client()
+	if _, err := tokens.TokenSource(42).Token(); err == nil {
+		t.Errorf("expected an error for a rejected JWT")
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/wenjielee1/github-bot/models"
+	"github.com/wenjielee1/github-bot/utils"
+)
+
+// SecretsBaselinePath is the path of the secrets baseline in the target repository.
+const SecretsBaselinePath = ".jambu-secrets-baseline"
+
+// fingerprintPattern matches the first field of a fingerprint line of the baseline.
+var fingerprintPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// SecretFingerprint identifies a finding by the SHA-256 of its file path and matched value,
+// so that it stays accepted when surrounding lines move.
+func SecretFingerprint(finding models.SecretFinding) string {
+	sum := sha256.Sum256([]byte(finding.File + "\x00" + finding.Match))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadSecretsBaseline fetches the secrets baseline at the given ref of the target repository, usually the base branch
+// of a pull request. An empty ref reads the default branch. A missing or unreadable baseline is treated as empty.
+func LoadSecretsBaseline(ctx context.Context, client *github.Client, owner, repo, ref string) *models.SecretsBaseline {
+	content, found, err := utils.GetFileContent(ctx, client, owner, repo, SecretsBaselinePath, ref)
+	if err != nil {
+		log.Printf("Error fetching %s from %s/%s, using an empty baseline: %v", SecretsBaselinePath, owner, repo, err)
+		return ParseSecretsBaseline("")
+	}
+	if !found {
+		return ParseSecretsBaseline("")
+	}
+	return ParseSecretsBaseline(content)
+}
+
+// ParseSecretsBaseline parses a secrets baseline. Every line is a fingerprint, optionally followed by a
+// comment, or a path glob. Blank lines and lines starting with "#" are ignored.
+func ParseSecretsBaseline(content string) *models.SecretsBaseline {
+	baseline := &models.SecretsBaseline{Fingerprints: map[string]string{}}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if fingerprintPattern.MatchString(fields[0]) {
+			baseline.Fingerprints[fields[0]] = strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+			continue
+		}
+		baseline.Paths = append(baseline.Paths, line)
+	}
+	return baseline
+}
+
+// findingFingerprint returns the fingerprint of a finding. The fingerprint computed when the finding was detected
+// is used if it is set, so that a finding whose matched value was dropped is still recognized.
+func findingFingerprint(finding models.SecretFinding) string {
+	if finding.Fingerprint != "" {
+		return finding.Fingerprint
+	}
+	return SecretFingerprint(finding)
+}
+
+// BaselineAllows reports whether the baseline accepts a finding, by fingerprint or path.
+func BaselineAllows(baseline *models.SecretsBaseline, finding models.SecretFinding) bool {
+	if _, ok := baseline.Fingerprints[findingFingerprint(finding)]; ok {
+		return true
+	}
+	return utils.MatchAnyGlob(baseline.Paths, finding.File)
+}
+
+// FilterBaseline drops the findings the baseline accepts.
+func FilterBaseline(baseline *models.SecretsBaseline, findings []models.SecretFinding) []models.SecretFinding {
+	var remaining []models.SecretFinding
+	for _, finding := range findings {
+		if BaselineAllows(baseline, finding) {
+			log.Printf("Ignoring %s in %s line %d, accepted by %s", finding.RuleID, finding.File, finding.Line, SecretsBaselinePath)
+			continue
+		}
+		remaining = append(remaining, finding)
+	}
+	return remaining
+}
+
+// FormatSecretsBaseline renders a baseline that accepts everything the existing baseline accepts plus the given findings.
+func FormatSecretsBaseline(existing *models.SecretsBaseline, findings []models.SecretFinding) string {
+	fingerprints := map[string]string{}
+	for fingerprint, comment := range existing.Fingerprints {
+		fingerprints[fingerprint] = comment
+	}
+	for _, finding := range findings {
+		fingerprint := findingFingerprint(finding)
+		if _, ok := fingerprints[fingerprint]; !ok {
+			fingerprints[fingerprint] = fmt.Sprintf("%s %s:%d", finding.RuleID, finding.File, finding.Line)
+		}
+	}
+
+	sorted := make([]string, 0, len(fingerprints))
+	for fingerprint := range fingerprints {
+		sorted = append(sorted, fingerprint)
+	}
+	sort.Strings(sorted)
+
+	var baseline strings.Builder
+	baseline.WriteString("# Secret findings accepted by JambuBot.\n")
+	baseline.WriteString("# Fingerprints are the SHA-256 of the file path and the matched value, followed by the rule and location.\n")
+	for _, fingerprint := range sorted {
+		baseline.WriteString(strings.TrimSpace(fingerprint+" "+fingerprints[fingerprint]) + "\n")
+	}
+	if len(existing.Paths) > 0 {
+		baseline.WriteString("\n# Paths whose findings are all accepted.\n")
+		for _, glob := range existing.Paths {
+			baseline.WriteString(glob + "\n")
+		}
+	}
+	return baseline.String()
+}
+
+// PullRequestSecretFindings runs the built-in secret rules on every commit of a pull request,
+// without adjudicating candidates with the LLM.
+func PullRequestSecretFindings(ctx context.Context, client *github.Client, owner, repo string, prNumber int) ([]models.SecretFinding, error) {
+	commits, err := listPullRequestCommits(ctx, client, owner, repo, prNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []models.SecretFinding
+	for _, commit := range commits {
+		// Merge commits only repeat changes of other commits
+		if len(commit.Parents) > 1 {
+			continue
+		}
+		files, err := getCommitFiles(ctx, client, owner, repo, commit.GetSHA())
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, DetectSecrets(ctx, commit.GetSHA(), files)...)
+	}
+	return findings, nil
+}
+
+// GenerateSecretsBaseline renders a baseline that accepts the current findings of a pull request in addition to
+// everything the baseline on the pull request's base branch already accepts. The pull request's own baseline is
+// not merged, as the secrets check only trusts the base branch's.
+func GenerateSecretsBaseline(ctx context.Context, client *github.Client, owner, repo string, prNumber int) (string, error) {
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, prNumber)
+	if err != nil {
+		return "", fmt.Errorf("error fetching PR #%d: %w", prNumber, err)
+	}
+	findings, err := PullRequestSecretFindings(ctx, client, owner, repo, prNumber)
+	if err != nil {
+		return "", err
+	}
+	existing := LoadSecretsBaseline(ctx, client, owner, repo, pr.GetBase().GetRef())
+	return FormatSecretsBaseline(existing, findings), nil
+}
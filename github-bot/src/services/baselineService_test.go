@@ -0,0 +1,35 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/wenjielee1/github-bot/models"
+)
+
+func TestBaselineAllowsRestoredFindings(t *testing.T) {
+	detected := models.SecretFinding{RuleID: "jwt", File: "tests/auth_test.go", Line: 3, Match: "eyJhbGciOiJIUzI1NiJ9.e30.sig"}
+	detected.Fingerprint = SecretFingerprint(detected)
+	baseline := ParseSecretsBaseline(detected.Fingerprint + " jwt tests/auth_test.go:3\n")
+
+	// Findings whose matched value was dropped are recognized by their stored fingerprint
+	restored := detected
+	restored.Match = ""
+
+	tests := []struct {
+		name    string
+		finding models.SecretFinding
+		want    bool
+	}{
+		{"detected finding", detected, true},
+		{"restored finding", restored, true},
+		{"other value", models.SecretFinding{File: "tests/auth_test.go", Match: "other-value-entirely"}, false},
+	}
+	for _, test := range tests {
+		if got := BaselineAllows(baseline, test.finding); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+	if remaining := FilterBaseline(baseline, []models.SecretFinding{restored}); len(remaining) != 0 {
+		t.Errorf("restored finding accepted by the baseline is still reported: %+v", remaining)
+	}
+}
@@ -0,0 +1,440 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/wenjielee1/github-bot/models"
+	"github.com/wenjielee1/github-bot/utils"
+)
+
+const (
+	// DefaultChangelogPath is the path of the changelog when the repository does not set one.
+	DefaultChangelogPath = "CHANGELOG.md"
+	// ApplyChangelogCommand is the comment that commits the suggested changelog section to a pull request's branch.
+	ApplyChangelogCommand = "/jambu apply-changelog"
+	// changelogSuggestionMarker precedes the suggested section in the changelog check's summary, where the
+	// apply-changelog command reads it from.
+	changelogSuggestionMarker = "<!-- jambu:changelog-entry -->"
+	// changelogReviewMarker marks the bot's suggestion comments on the changelog, so that stale ones are replaced.
+	changelogReviewMarker = "<!-- jambu:changelog-suggestion -->"
+	// changelogFence fences the suggested section. It is longer than the fences an entry might contain.
+	changelogFence = "````"
+	// unreleasedHeading is the heading of the section that entries of unreleased changes go in.
+	unreleasedHeading = "## [Unreleased]"
+)
+
+// changelogSections are the Keep a Changelog section names, upper-cased, that entries may be listed under.
+var changelogSections = []string{"ADDED", "CHANGED", "FIXED", "CHANGED / FIXED", "DEPRECATED", "REMOVED", "SECURITY"}
+
+// changelogSectionHeadings lists the section names as they are usually written, for problem messages.
+const changelogSectionHeadings = "Added, Changed, Fixed, Deprecated, Removed or Security"
+
+var (
+	// changelogVersionPattern matches a version heading such as "## [Unreleased]" or "## [1.2.0] - 2024-07-01".
+	changelogVersionPattern = regexp.MustCompile(`^##\s+(.+?)\s*$`)
+	// changelogSectionPattern matches a section heading such as "### Added".
+	changelogSectionPattern = regexp.MustCompile(`^###\s+(.+?)\s*$`)
+	// changelogEntryPattern matches a list item, which is an entry of a section.
+	changelogEntryPattern = regexp.MustCompile(`^\s*[-*+]\s+\S`)
+	// changelogLinkPattern matches a link reference definition such as "[Unreleased]: https://...", which usually
+	// closes the changelog.
+	changelogLinkPattern = regexp.MustCompile(`^\[[^\]]+\]:\s`)
+)
+
+// ChangelogProblem is a way in which a changelog update does not follow Keep a Changelog.
+type ChangelogProblem struct {
+	Line    int    // The line of the changelog the problem is on, 0 for problems with the update as a whole.
+	Message string // A description of the problem.
+}
+
+// ChangelogValidation is the result of validating the lines a pull request adds to the changelog.
+type ChangelogValidation struct {
+	Entries  int                // The number of entries added under a version and a known section.
+	Problems []ChangelogProblem // The problems found, empty if the update is well-formed.
+}
+
+// Valid reports whether the update adds at least one entry and has no problems.
+func (v ChangelogValidation) Valid() bool {
+	return v.Entries > 0 && len(v.Problems) == 0
+}
+
+// ValidateChangelog checks the lines a patch adds to a changelog against the structure of Keep a Changelog.
+// The content is the whole changelog after the patch, so that added entries can be placed under the version and
+// section headings around them, even when those headings are not part of the patch. Entries only count under
+// [Unreleased], released versions are not changed after the fact.
+func ValidateChangelog(content, patch string) (ChangelogValidation, error) {
+	var validation ChangelogValidation
+	added, err := utils.AddedLines(patch)
+	if err != nil {
+		return validation, fmt.Errorf("error parsing changelog patch: %w", err)
+	}
+
+	// Find the version and section every line of the changelog is in
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	versions := make([]string, len(lines)+1)
+	sections := make([]string, len(lines)+1)
+	version, section := "", ""
+	for i, line := range lines {
+		if match := changelogSectionPattern.FindStringSubmatch(line); match != nil {
+			section = match[1]
+		} else if match := changelogVersionPattern.FindStringSubmatch(line); match != nil {
+			version, section = match[1], ""
+		}
+		versions[i+1], sections[i+1] = version, section
+	}
+
+	for _, line := range added {
+		if line.NewLine < 1 || line.NewLine > len(lines) {
+			continue
+		}
+		if match := changelogSectionPattern.FindStringSubmatch(line.Text); match != nil && !knownChangelogSection(match[1]) {
+			validation.Problems = append(validation.Problems, ChangelogProblem{Line: line.NewLine, Message: fmt.Sprintf("%q is not a Keep a Changelog section, use %s.", match[1], changelogSectionHeadings)})
+			continue
+		}
+		if !changelogEntryPattern.MatchString(line.Text) {
+			continue
+		}
+		switch {
+		case versions[line.NewLine] == "":
+			validation.Problems = append(validation.Problems, ChangelogProblem{Line: line.NewLine, Message: "The entry is not under a version heading such as \"## [Unreleased]\"."})
+		case !isUnreleased(versions[line.NewLine]):
+			validation.Problems = append(validation.Problems, ChangelogProblem{Line: line.NewLine, Message: fmt.Sprintf("The entry is under %s, which was already released. Add it under \"## [Unreleased]\" instead.", versions[line.NewLine])})
+		case sections[line.NewLine] == "":
+			validation.Problems = append(validation.Problems, ChangelogProblem{Line: line.NewLine, Message: fmt.Sprintf("The entry is not under a section heading such as \"### Added\" in %s.", versions[line.NewLine])})
+		case !knownChangelogSection(sections[line.NewLine]):
+			// An unknown heading the pull request added is reported once, above; entries under an existing one each are
+			if !addsSection(added, sections[line.NewLine]) {
+				validation.Problems = append(validation.Problems, ChangelogProblem{Line: line.NewLine, Message: fmt.Sprintf("The entry is under %q, which is not a Keep a Changelog section.", sections[line.NewLine])})
+			}
+		default:
+			validation.Entries++
+		}
+	}
+
+	if validation.Entries == 0 && len(validation.Problems) == 0 {
+		validation.Problems = append(validation.Problems, ChangelogProblem{Message: "The changelog was changed, but no entry was added."})
+	}
+	return validation, nil
+}
+
+// isUnreleased reports whether a version heading is the [Unreleased] section, ignoring case.
+func isUnreleased(version string) bool {
+	return strings.Contains(strings.ToUpper(version), "UNRELEASED")
+}
+
+// knownChangelogSection reports whether a section heading is one of the Keep a Changelog sections, ignoring case.
+func knownChangelogSection(name string) bool {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	for _, section := range changelogSections {
+		if name == section {
+			return true
+		}
+	}
+	return false
+}
+
+// addsSection reports whether one of the added lines is a section heading with the given name.
+func addsSection(lines []utils.DiffLine, section string) bool {
+	for _, line := range lines {
+		if match := changelogSectionPattern.FindStringSubmatch(line.Text); match != nil && match[1] == section {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatChangelogProblems renders the problems as a markdown list.
+func FormatChangelogProblems(path string, problems []ChangelogProblem) string {
+	var text strings.Builder
+	for _, problem := range problems {
+		if problem.Line > 0 {
+			text.WriteString(fmt.Sprintf("- `%s` line %d: %s\n", path, problem.Line, problem.Message))
+		} else {
+			text.WriteString(fmt.Sprintf("- %s\n", problem.Message))
+		}
+	}
+	return text.String()
+}
+
+// unreleasedSection finds the [Unreleased] section among the lines of a changelog. It returns the line numbers of
+// its heading and of its last non-blank line, which is the heading itself if the section is empty.
+func unreleasedSection(lines []string) (int, int, bool) {
+	start := 0
+	for i, line := range lines {
+		match := changelogVersionPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if start > 0 {
+			break
+		}
+		if isUnreleased(match[1]) {
+			start = i + 1
+		}
+	}
+	if start == 0 {
+		return 0, 0, false
+	}
+
+	end := start
+	for i := start; i < len(lines); i++ {
+		if changelogVersionPattern.MatchString(lines[i]) || changelogLinkPattern.MatchString(lines[i]) {
+			break
+		}
+		if strings.TrimSpace(lines[i]) != "" {
+			end = i + 1
+		}
+	}
+	return start, end, true
+}
+
+// changelogLines splits a changelog into lines.
+func changelogLines(content string) []string {
+	return strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+}
+
+// UnreleasedEntries returns the content of the [Unreleased] section of a changelog, without its heading.
+func UnreleasedEntries(content string) string {
+	lines := changelogLines(content)
+	start, end, ok := unreleasedSection(lines)
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(strings.Join(lines[start:end], "\n"))
+}
+
+// ApplyChangelogSection replaces the content of the [Unreleased] section of a changelog. If the changelog has no
+// such section, one is added above the latest version, or a new changelog is started if the content is empty.
+func ApplyChangelogSection(content, section string) string {
+	lines := changelogLines(content)
+	if start, end, ok := unreleasedSection(lines); ok {
+		replaced := append([]string{}, lines[:start]...)
+		replaced = append(replaced, "", section)
+		return strings.Join(append(replaced, lines[end:]...), "\n")
+	}
+
+	for i, line := range lines {
+		if changelogVersionPattern.MatchString(line) {
+			added := append([]string{}, lines[:i]...)
+			added = append(added, unreleasedHeading, "", section, "")
+			return strings.Join(append(added, lines[i:]...), "\n")
+		}
+	}
+	if strings.TrimSpace(content) == "" {
+		return "# Changelog\n\nAll notable changes to this project will be documented in this file.\n\n" + unreleasedHeading + "\n\n" + section + "\n"
+	}
+	return strings.TrimRight(content, "\n") + "\n\n" + unreleasedHeading + "\n\n" + section + "\n"
+}
+
+// NormalizeChangelogSection extracts the content of the [Unreleased] section from the LLM's response: the lines
+// from the first section heading up to the next version heading or code fence, without surrounding prose.
+func NormalizeChangelogSection(response string) string {
+	var section []string
+	for _, line := range changelogLines(strings.TrimSpace(response)) {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") || changelogVersionPattern.MatchString(line) {
+			if len(section) > 0 {
+				break
+			}
+			continue
+		}
+		if len(section) == 0 && !changelogSectionPattern.MatchString(line) {
+			continue
+		}
+		section = append(section, strings.TrimRight(line, " \t"))
+	}
+
+	// Drop prose after the last entry, entries may continue on indented lines
+	for len(section) > 0 {
+		last := section[len(section)-1]
+		if last != "" && (changelogSectionPattern.MatchString(last) || changelogEntryPattern.MatchString(last) || strings.HasPrefix(last, " ") || strings.HasPrefix(last, "\t")) {
+			break
+		}
+		section = section[:len(section)-1]
+	}
+	return strings.Join(section, "\n")
+}
+
+// validateChangelogSection validates the content of an [Unreleased] section as if all of it were added.
+func validateChangelogSection(section string) ChangelogValidation {
+	content := unreleasedHeading + "\n\n" + section
+	lines := changelogLines(content)
+	patch := fmt.Sprintf("@@ -0,0 +1,%d @@\n+%s", len(lines), strings.Join(lines, "\n+"))
+	validation, err := ValidateChangelog(content, patch)
+	if err != nil {
+		return ChangelogValidation{Problems: []ChangelogProblem{{Message: err.Error()}}}
+	}
+	return validation
+}
+
+// FormatChangelogSuggestion renders the suggested [Unreleased] section for the changelog check's summary.
+func FormatChangelogSuggestion(section string) string {
+	return fmt.Sprintf("%s\n%smarkdown\n%s\n\n%s\n%s", changelogSuggestionMarker, changelogFence, unreleasedHeading, section, changelogFence)
+}
+
+// ParseChangelogSuggestion reads the suggested [Unreleased] section from the changelog check's summary.
+// The returned bool is false if the summary has none.
+func ParseChangelogSuggestion(summary string) (string, bool) {
+	_, rest, ok := strings.Cut(summary, changelogSuggestionMarker+"\n"+changelogFence+"markdown\n")
+	if !ok {
+		return "", false
+	}
+	block, _, ok := strings.Cut(rest, "\n"+changelogFence)
+	if !ok {
+		return "", false
+	}
+	section := NormalizeChangelogSection(block)
+	return section, section != ""
+}
+
+// SuggestChangelogSection posts the suggested [Unreleased] section as a suggestion on the changelog, replacing
+// the section's lines, so that it can be committed from the pull request. It returns false if the section is not
+// part of the pull request's diff, as suggestions can only be made on lines of the diff. A previous suggestion
+// of the bot is replaced, unless it suggests the same section on lines that did not change since.
+func SuggestChangelogSection(ctx context.Context, client *github.Client, owner, repo string, pr *models.PullRequest, changelog *github.CommitFile, content, section string) (bool, error) {
+	// Find the section's lines in the diff
+	lines := changelogLines(content)
+	start, end, ok := unreleasedSection(lines)
+	if !ok {
+		return false, nil
+	}
+	hunks, err := utils.ParsePatch(changelog.GetPatch())
+	if err != nil {
+		return false, fmt.Errorf("error parsing patch of %s: %w", changelog.GetFilename(), err)
+	}
+	if !utils.DiffRange(hunks, start, end) {
+		return false, nil
+	}
+
+	body := fmt.Sprintf("%s\nJambo! Here is the `[Unreleased]` section with an entry for this pull request:\n\n```suggestion\n%s\n\n%s\n```", changelogReviewMarker, lines[start-1], section)
+
+	// Replace the bot's previous suggestions, which are stale
+	comments, err := utils.ListAll(func(opts *github.ListOptions) ([]*github.PullRequestComment, *github.Response, error) {
+		return client.PullRequests.ListComments(ctx, owner, repo, pr.Number, &github.PullRequestListCommentsOptions{ListOptions: *opts})
+	})
+	if err != nil {
+		return false, fmt.Errorf("error listing review comments on PR #%d: %w", pr.Number, err)
+	}
+	for _, comment := range comments {
+		if !isBotUser(ctx, comment.GetUser()) || !strings.HasPrefix(comment.GetBody(), changelogReviewMarker) {
+			continue
+		}
+		// Outdated comments have no position in the current diff
+		if comment.GetBody() == utils.Redact(ctx, body) && comment.Position != nil {
+			return true, nil
+		}
+		if _, err := client.PullRequests.DeleteComment(ctx, owner, repo, comment.GetID()); err != nil {
+			log.Printf("Error deleting changelog suggestion %d on PR #%d: %v", comment.GetID(), pr.Number, err)
+		}
+	}
+
+	comment := models.ReviewComment{File: changelog.GetFilename(), Line: end, Body: body}
+	if start < end {
+		comment.StartLine = start
+	}
+	review := fmt.Sprintf("Jambo! I suggested a changelog entry on `%s`.", changelog.GetFilename())
+	if err := SubmitReview(ctx, client, owner, repo, pr, []*github.CommitFile{changelog}, review, []models.ReviewComment{comment}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// LoadChangelogSuggestion reads the [Unreleased] section the changelog check suggested for a commit, from the check
+// run of the bot's App or, if the bot reports in comments, from the check's comment. The returned bool is false if
+// the check suggested none for the commit.
+func LoadChangelogSuggestion(ctx context.Context, client *github.Client, owner, repo string, number int, sha string) (string, bool, error) {
+	runs, _, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha, &github.ListCheckRunsOptions{
+		CheckName: github.String(ChangelogCheckRunName),
+		Status:    github.String("completed"),
+		Filter:    github.String("latest"),
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("error listing check runs of %s: %w", sha, err)
+	}
+	for _, run := range runs.CheckRuns {
+		// Anyone who can push to the pull request can create a check run of the same name
+		if !ownCheckRun(ctx, run) {
+			log.Printf("Ignoring check run %d of %s, it was not created by this App", run.GetID(), sha)
+			continue
+		}
+		if section, ok := ParseChangelogSuggestion(run.GetOutput().GetSummary()); ok {
+			return section, true, nil
+		}
+	}
+
+	// The comment's footer names the commit it was last changed for
+	comment, _, err := findStickyComment(ctx, client, owner, repo, number, ChangelogCheckName)
+	if err != nil || comment == nil || !strings.Contains(comment.GetBody(), "commit "+sha+".") {
+		return "", false, err
+	}
+	section, ok := ParseChangelogSuggestion(comment.GetBody())
+	return section, ok, nil
+}
+
+// ApplyChangelog commits the [Unreleased] section the changelog check suggested for the head of a pull request
+// to the pull request's branch. It returns the reply to the command, which explains why nothing was committed if
+// the section cannot be applied, e.g. because the pull request comes from a fork.
+func ApplyChangelog(ctx context.Context, client *github.Client, config *models.BotConfig, owner, repo string, number int) (string, error) {
+	path := config.Changelog.Path
+
+	// Fetch the pull request's head, the suggestion must be for its latest commit
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, number)
+	if err != nil {
+		return "", fmt.Errorf("error fetching PR #%d: %w", number, err)
+	}
+	if pr.GetState() != "open" {
+		return "Jambo! This pull request is not open anymore, so I left its branch alone.", nil
+	}
+	head := pr.GetHead()
+	if !strings.EqualFold(head.GetRepo().GetFullName(), owner+"/"+repo) {
+		return fmt.Sprintf("Jambo! I cannot push to `%s`, as this pull request comes from a fork. Copy the section from the JambuBot changelog check into `%s` instead.", head.GetLabel(), path), nil
+	}
+	section, ok, err := LoadChangelogSuggestion(ctx, client, owner, repo, number, head.GetSHA())
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return fmt.Sprintf("Jambo! I have no changelog suggestion for the latest commit of this pull request. Wait for the changelog check to finish, or re-run it, and comment `%s` again.", ApplyChangelogCommand), nil
+	}
+
+	// Read the changelog at the commit the suggestion is for, so that the update fails if the branch moved on
+	file, _, resp, err := client.Repositories.GetContents(ctx, owner, repo, path, &github.RepositoryContentGetOptions{Ref: head.GetSHA()})
+	var content string
+	switch {
+	case err != nil && resp != nil && resp.StatusCode == http.StatusNotFound:
+	case err != nil:
+		return "", fmt.Errorf("error fetching %s: %w", path, err)
+	case file == nil:
+		return fmt.Sprintf("Jambo! `%s` is a directory, so I cannot add the entry to it.", path), nil
+	default:
+		if content, err = file.GetContent(); err != nil {
+			return "", fmt.Errorf("error decoding %s: %w", path, err)
+		}
+	}
+	updated := ApplyChangelogSection(content, section)
+	if updated == content {
+		return fmt.Sprintf("Jambo! `%s` already has the suggested entry.", path), nil
+	}
+
+	opts := &github.RepositoryContentFileOptions{
+		Message: github.String(fmt.Sprintf("Add changelog entry for #%d", number)),
+		Content: []byte(updated),
+		Branch:  github.String(head.GetRef()),
+	}
+	write := client.Repositories.CreateFile
+	if file != nil {
+		opts.SHA = github.String(file.GetSHA())
+		write = client.Repositories.UpdateFile
+	}
+	commit, _, err := write(ctx, owner, repo, path, opts)
+	if err != nil {
+		return "", fmt.Errorf("error committing %s to %s: %w", path, head.GetRef(), err)
+	}
+	log.Printf("Committed the changelog entry of PR #%d as %s", number, commit.GetSHA())
+	return fmt.Sprintf("Jambo! I added the entry to `%s` in %s.", path, commit.GetSHA()), nil
+}
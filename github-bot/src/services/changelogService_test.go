@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v41/github"
+)
+
+func TestLoadChangelogSuggestionOnlyTrustsOwnCheckRuns(t *testing.T) {
+	forged := checkRunOf(2, "Jambo!\n\n"+FormatChangelogSuggestion("### Added\n- Something the author wants merged."), "")
+	own := checkRunOf(1, "Jambo!\n\n"+FormatChangelogSuggestion("### Fixed\n- Suggested by the bot."), "")
+	client := checkRunsServer(t, []*github.CheckRun{forged, own})
+
+	section, ok, err := LoadChangelogSuggestion(WithAppID(context.Background(), 1), client, "o", "r", 1, "head")
+	if err != nil || !ok || section != "### Fixed\n- Suggested by the bot." {
+		t.Errorf("got (%q, %v, %v), want the section of the bot's own check run", section, ok, err)
+	}
+	if section, ok, err := LoadChangelogSuggestion(WithAppID(context.Background(), 3), client, "o", "r", 1, "head"); err != nil || ok {
+		t.Errorf("got (%q, %v, %v) from check runs of other Apps", section, ok, err)
+	}
+	if section, ok, err := LoadChangelogSuggestion(context.Background(), client, "o", "r", 1, "head"); err != nil || ok {
+		t.Errorf("got (%q, %v, %v) without knowing the App's ID", section, ok, err)
+	}
+}
+
+// releasedChangelog is a changelog with an [Unreleased] section and a released version.
+const releasedChangelog = `# Changelog
+
+## [Unreleased]
+
+### Added
+- Existing entry.
+
+## [1.0.0] - 2024-01-01
+
+### Fixed
+- Released fix.
+
+[Unreleased]: https://example.com/compare/v1.0.0...HEAD`
+
+func TestValidateChangelog(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		added    []int // The lines of the content the patch adds.
+		entries  int
+		problems []string
+	}{
+		{"entry under Unreleased", releasedChangelog, []int{6}, 1, nil},
+		{"entry under a released version", releasedChangelog, []int{11}, 0, []string{"already released"}},
+		{"entry without a version", "# Changelog\n\n- Loose entry.", []int{3}, 0, []string{"not under a version heading"}},
+		{"entry without a section", "## [Unreleased]\n\n- Entry.", []int{3}, 0, []string{"not under a section heading"}},
+		{"unknown section added", "## [Unreleased]\n\n### Improvements\n- Entry.", []int{3, 4}, 0, []string{"not a Keep a Changelog section"}},
+		{"entry under an existing unknown section", "## [Unreleased]\n\n### Improvements\n- Entry.", []int{4}, 0, []string{"is under \"Improvements\""}},
+		{"section names ignore case", "## [unreleased]\n\n### CHANGED / FIXED\n- Entry.", []int{4}, 1, nil},
+		{"no entry added", releasedChangelog, []int{2}, 0, []string{"no entry was added"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := changelogLines(test.content)
+			var patch strings.Builder
+			for _, line := range test.added {
+				patch.WriteString(fmt.Sprintf("@@ -%d,0 +%d @@\n+%s\n", line-1, line, lines[line-1]))
+			}
+			validation, err := ValidateChangelog(test.content, patch.String())
+			if err != nil {
+				t.Fatalf("ValidateChangelog: %v", err)
+			}
+			if validation.Entries != test.entries || len(validation.Problems) != len(test.problems) {
+				t.Fatalf("got %d entries and problems %+v, want %d entries and %d problems", validation.Entries, validation.Problems, test.entries, len(test.problems))
+			}
+			for i, problem := range validation.Problems {
+				if !strings.Contains(problem.Message, test.problems[i]) {
+					t.Errorf("got problem %q, want one about %q", problem.Message, test.problems[i])
+				}
+			}
+			if validation.Valid() != (test.entries > 0 && len(test.problems) == 0) {
+				t.Errorf("got Valid() = %v", validation.Valid())
+			}
+		})
+	}
+}
+
+func TestNormalizeChangelogSection(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{"section only", "### Added\n- Entry.", "### Added\n- Entry."},
+		{"prose and fence around it", "Jambo! Here you go:\n```markdown\n## [Unreleased]\n\n### Fixed\n- Bug.\n```\nHope this helps!", "### Fixed\n- Bug."},
+		{"several sections with continuation lines", "### Added\n- Entry\n  continued.\n\n### Removed\n- Old API.\n\nLet me know.", "### Added\n- Entry\n  continued.\n\n### Removed\n- Old API."},
+		{"stops at the next version", "### Added\n- New.\n## [1.0.0]\n### Fixed\n- Old.", "### Added\n- New."},
+		{"no section", "Jambo! Nothing to add.", ""},
+	}
+	for _, test := range tests {
+		if got := NormalizeChangelogSection(test.response); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestApplyChangelogSection(t *testing.T) {
+	section := "### Added\n- New entry."
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "replaces Unreleased",
+			content: releasedChangelog,
+			want:    "# Changelog\n\n## [Unreleased]\n\n### Added\n- New entry.\n\n## [1.0.0] - 2024-01-01\n\n### Fixed\n- Released fix.\n\n[Unreleased]: https://example.com/compare/v1.0.0...HEAD",
+		},
+		{
+			name:    "adds Unreleased above the latest version",
+			content: "# Changelog\n\n## [1.0.0]\n- Old.",
+			want:    "# Changelog\n\n## [Unreleased]\n\n### Added\n- New entry.\n\n## [1.0.0]\n- Old.",
+		},
+		{
+			name:    "appends Unreleased without versions",
+			content: "# Changelog\n",
+			want:    "# Changelog\n\n## [Unreleased]\n\n### Added\n- New entry.\n",
+		},
+		{
+			name:    "starts a changelog",
+			content: "",
+			want:    "# Changelog\n\nAll notable changes to this project will be documented in this file.\n\n## [Unreleased]\n\n### Added\n- New entry.\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ApplyChangelogSection(test.content, section)
+			if got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+			if UnreleasedEntries(got) != section {
+				t.Errorf("got [Unreleased] entries %q, want the section", UnreleasedEntries(got))
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/wenjielee1/github-bot/models"
+	"github.com/wenjielee1/github-bot/utils"
+)
+
+const (
+	// ChangelogCheckRunName is the name of the check run the changelog check is reported in.
+	ChangelogCheckRunName = "JambuBot changelog"
+	// SecretsCheckRunName is the name of the check run the secret check is reported in.
+	SecretsCheckRunName = "JambuBot secrets"
+	// maxCheckRunAnnotations is the number of annotations GitHub accepts in a single check run request.
+	maxCheckRunAnnotations = 50
+	// maxCheckRunSummary is the longest summary GitHub accepts, in characters.
+	maxCheckRunSummary = 65535
+)
+
+// ChangelogCheckName is the name of the changelog check, as used in the markers of its comments.
+const ChangelogCheckName = "changelog"
+
+// checkRunNames maps the names of the pull request checks to the names of their check runs.
+var checkRunNames = map[string]string{
+	ChangelogCheckName: ChangelogCheckRunName,
+	SecretsCheckName:   SecretsCheckRunName,
+}
+
+// Conclusions of a completed check run.
+const (
+	ConclusionSuccess = "success"
+	ConclusionFailure = "failure"
+	ConclusionNeutral = "neutral"
+)
+
+// CheckReport reports the outcome of one check on a pull request as a check run on the pull request's head commit.
+// The check run is created in progress when the check starts and completed with a title, markdown summary and
+// annotations when it ends. If the App may not create check runs, e.g. because it lacks the Checks: write
+// permission, the report falls back to a sticky comment on the pull request for outcomes that need attention.
+type CheckReport struct {
+	client    *github.Client
+	owner     string
+	repo      string
+	prNumber  int
+	headSHA   string
+	check     string   // The name of the check, which keys its sticky comment.
+	name      string   // The name of the check run.
+	runID     int64    // The ID of the check run, or 0 if the report falls back to comments.
+	notes     []string // Paragraphs appended to the summary, such as problems running parts of the check.
+	text      string   // The text of the check run, such as hidden state for the next run.
+	completed bool
+}
+
+// appIDKey is the context key of the ID of the GitHub App the bot runs as.
+type appIDKey struct{}
+
+// WithAppID returns a context that carries the ID of the GitHub App the bot runs as, so that it recognizes its own
+// check runs.
+func WithAppID(ctx context.Context, id int64) context.Context {
+	return context.WithValue(ctx, appIDKey{}, id)
+}
+
+// IsOwnApp reports whether the App with the given ID is the App the bot runs as. Without the bot's App ID in the
+// context, no App is trusted.
+func IsOwnApp(ctx context.Context, appID int64) bool {
+	id, _ := ctx.Value(appIDKey{}).(int64)
+	return id != 0 && appID == id
+}
+
+// ownCheckRun reports whether a check run was created by the bot's App. Other Apps and workflows can create
+// check runs with the same name, so state is only read from the bot's own.
+func ownCheckRun(ctx context.Context, run *github.CheckRun) bool {
+	return IsOwnApp(ctx, run.GetApp().GetID())
+}
+
+// StartCheckReport creates the check run of a check in progress on the pull request's head commit.
+func StartCheckReport(ctx context.Context, client *github.Client, owner, repo string, pr *models.PullRequest, check string) *CheckReport {
+	name := checkRunNames[check]
+	report := &CheckReport{client: client, owner: owner, repo: repo, prNumber: pr.Number, headSHA: pr.Head.SHA, check: check, name: name}
+	if pr.Head.SHA == "" {
+		log.Printf("No head commit for PR #%d, reporting %s in comments", pr.Number, name)
+		return report
+	}
+
+	run, _, err := client.Checks.CreateCheckRun(ctx, owner, repo, github.CreateCheckRunOptions{
+		Name:      name,
+		HeadSHA:   pr.Head.SHA,
+		Status:    github.String("in_progress"),
+		StartedAt: &github.Timestamp{Time: time.Now()},
+	})
+	if err != nil {
+		log.Printf("Error creating check run %s for PR #%d, reporting in comments: %v", name, pr.Number, err)
+		return report
+	}
+	report.runID = run.GetID()
+	return report
+}
+
+// HasCheckRun reports whether the check is reported in a check run rather than in comments.
+func (r *CheckReport) HasCheckRun() bool {
+	return r.runID != 0
+}
+
+// Completed reports whether the check has been completed.
+func (r *CheckReport) Completed() bool {
+	return r.completed
+}
+
+// Note adds a paragraph to the summary the check is completed with.
+func (r *CheckReport) Note(text string) {
+	if text != "" {
+		r.notes = append(r.notes, text)
+	}
+}
+
+// SetText sets the text of the check run, shown below its summary. Without a check run, the text is dropped.
+func (r *CheckReport) SetText(text string) {
+	r.text = text
+}
+
+// Complete concludes the check. Annotations beyond the number GitHub accepts per request are added in further
+// updates of the check run. Without a check run, the summary goes to the check's sticky comment, which is only
+// created if the check did not succeed, and the annotations are dropped. Secrets in the title, summary and
+// annotations are masked.
+func (r *CheckReport) Complete(ctx context.Context, conclusion, title, summary string, annotations []*github.CheckRunAnnotation) {
+	if r.completed {
+		return
+	}
+	r.completed = true
+	summary = utils.Redact(ctx, strings.Join(append([]string{summary}, r.notes...), "\n\n"))
+	summary = strings.TrimSpace(summary)
+
+	if !r.HasCheckRun() {
+		var err error
+		switch {
+		case summary == "":
+		case conclusion == ConclusionSuccess:
+			err = UpdateStickyComment(ctx, r.client, r.owner, r.repo, r.prNumber, r.check, r.headSHA, summary)
+		default:
+			err = UpsertStickyComment(ctx, r.client, r.owner, r.repo, r.prNumber, r.check, r.headSHA, summary)
+		}
+		if err != nil {
+			log.Printf("Error reporting %s check on PR #%d: %v", r.check, r.prNumber, err)
+		}
+		return
+	}
+
+	if len(summary) > maxCheckRunSummary {
+		summary = summary[:maxCheckRunSummary-3] + "..."
+	}
+	for _, annotation := range annotations {
+		annotation.Message = github.String(utils.Redact(ctx, annotation.GetMessage()))
+	}
+	output := func(batch []*github.CheckRunAnnotation) *github.CheckRunOutput {
+		output := &github.CheckRunOutput{
+			Title:       github.String(utils.Redact(ctx, title)),
+			Summary:     github.String(summary),
+			Annotations: batch,
+		}
+		if r.text != "" {
+			output.Text = github.String(r.text)
+		}
+		return output
+	}
+
+	// The first update completes the check run, later ones add the remaining annotations
+	first := annotations
+	if len(first) > maxCheckRunAnnotations {
+		first = first[:maxCheckRunAnnotations]
+	}
+	_, _, err := r.client.Checks.UpdateCheckRun(ctx, r.owner, r.repo, r.runID, github.UpdateCheckRunOptions{
+		Name:        r.name,
+		Status:      github.String("completed"),
+		Conclusion:  github.String(conclusion),
+		CompletedAt: &github.Timestamp{Time: time.Now()},
+		Output:      output(first),
+	})
+	if err != nil {
+		log.Printf("Error completing check run %s for PR #%d: %v", r.name, r.prNumber, err)
+		RecordError(ctx, fmt.Errorf("error completing check run %s: %w", r.name, err))
+		return
+	}
+	for start := maxCheckRunAnnotations; start < len(annotations); start += maxCheckRunAnnotations {
+		end := start + maxCheckRunAnnotations
+		if end > len(annotations) {
+			end = len(annotations)
+		}
+		_, _, err := r.client.Checks.UpdateCheckRun(ctx, r.owner, r.repo, r.runID, github.UpdateCheckRunOptions{
+			Name:   r.name,
+			Output: output(annotations[start:end]),
+		})
+		if err != nil {
+			log.Printf("Error adding annotations to check run %s for PR #%d: %v", r.name, r.prNumber, err)
+			return
+		}
+	}
+}
+
+// Fail concludes a check that could not run because of an error talking to GitHub. The check run is completed
+// as neutral, so that it does not block merging on its own. Without a check run, nothing is posted.
+func (r *CheckReport) Fail(ctx context.Context, err error) {
+	RecordError(ctx, fmt.Errorf("%s: %w", r.name, err))
+	if !r.HasCheckRun() {
+		r.completed = true
+		return
+	}
+	r.Complete(ctx, ConclusionNeutral, "The check could not run", fmt.Sprintf("Jambo! I could not run this check: %v\n\nRe-run the check to try again.", err), nil)
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"context"
+	"testing"
+)
+
+func TestIsOwnApp(t *testing.T) {
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		appID int64
+		want  bool
+	}{
+		{"own app", WithAppID(context.Background(), 7), 7, true},
+		{"other app", WithAppID(context.Background(), 7), 8, false},
+		{"no app on the run", WithAppID(context.Background(), 7), 0, false},
+		{"no app id in context", context.Background(), 7, false},
+		{"neither", context.Background(), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsOwnApp(tt.ctx, tt.appID); got != tt.want {
+				t.Errorf("IsOwnApp(%d) = %v, want %v", tt.appID, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/go-github/v41/github"
+)
+
+const (
+	// defaultChunkTokens is the token budget of one diff chunk when TRIAGE_BOT_SECRETS_CHUNK_TOKENS is not set.
+	defaultChunkTokens = 4000
+	// minChunkTokens is the smallest budget a chunk is split down to when the model still rejects it as too long.
+	minChunkTokens = 250
+	// charsPerToken is a conservative estimate of the characters per token of code and diffs.
+	charsPerToken = 4
+)
+
+// DiffPiece is a part of a file's patch that is scanned as a whole: the full patch, a single hunk,
+// or a slice of the lines of a hunk that is too long on its own, prefixed with the hunk header.
+type DiffPiece struct {
+	File  string // The path of the changed file.
+	Patch string // The unified diff text of the piece.
+}
+
+// DiffChunk is a set of diff pieces that fits into the token budget of one scan.
+type DiffChunk struct {
+	Pieces []DiffPiece
+}
+
+// String renders the chunk in the same "File: <path>" format the prompts were written for.
+func (c DiffChunk) String() string {
+	var text strings.Builder
+	for _, piece := range c.Pieces {
+		text.WriteString(fmt.Sprintf("File: %s\n%s\n", piece.File, piece.Patch))
+	}
+	return text.String()
+}
+
+// Files returns the distinct files the chunk covers, in order.
+func (c DiffChunk) Files() []string {
+	var files []string
+	for _, piece := range c.Pieces {
+		if len(files) == 0 || files[len(files)-1] != piece.File {
+			files = append(files, piece.File)
+		}
+	}
+	return files
+}
+
+// ChunkTokens returns the token budget of a diff chunk from TRIAGE_BOT_SECRETS_CHUNK_TOKENS.
+func ChunkTokens() int {
+	tokens := getEnvInt("TRIAGE_BOT_SECRETS_CHUNK_TOKENS", defaultChunkTokens)
+	if tokens < minChunkTokens {
+		return minChunkTokens
+	}
+	return tokens
+}
+
+// EstimateTokens estimates the number of tokens of a text from its length.
+func EstimateTokens(text string) int {
+	return (len(text) + charsPerToken - 1) / charsPerToken
+}
+
+// ChunkDiff splits the patches of a commit's files into chunks of at most maxTokens estimated tokens.
+// Files are kept whole where possible, split per hunk when too long, and long hunks are split per line.
+func ChunkDiff(files []*github.CommitFile, maxTokens int) []DiffChunk {
+	var pieces []DiffPiece
+	for _, file := range files {
+		if file.GetPatch() == "" {
+			continue
+		}
+		pieces = append(pieces, SplitPatch(file.GetFilename(), file.GetPatch(), maxTokens)...)
+	}
+	return packPieces(pieces, maxTokens)
+}
+
+// RechunkDiff splits a chunk that was still too long for the model into smaller chunks.
+func RechunkDiff(chunk DiffChunk, maxTokens int) []DiffChunk {
+	var pieces []DiffPiece
+	for _, piece := range chunk.Pieces {
+		pieces = append(pieces, SplitPatch(piece.File, piece.Patch, maxTokens)...)
+	}
+	return packPieces(pieces, maxTokens)
+}
+
+// SplitPatch splits the patch of one file into pieces of at most maxTokens estimated tokens.
+func SplitPatch(file, patch string, maxTokens int) []DiffPiece {
+	if pieceTokens(file, patch) <= maxTokens {
+		return []DiffPiece{{File: file, Patch: patch}}
+	}
+
+	var pieces []DiffPiece
+	for _, hunk := range splitHunks(patch) {
+		if pieceTokens(file, hunk) <= maxTokens {
+			pieces = append(pieces, DiffPiece{File: file, Patch: hunk})
+			continue
+		}
+		pieces = append(pieces, splitHunkLines(file, hunk, maxTokens)...)
+	}
+	return pieces
+}
+
+// splitHunks splits a patch at every "@@" hunk header. Text before the first header stays with the first hunk.
+func splitHunks(patch string) []string {
+	var hunks []string
+	var current strings.Builder
+	for _, line := range strings.SplitAfter(patch, "\n") {
+		if strings.HasPrefix(line, "@@") && current.Len() > 0 {
+			hunks = append(hunks, current.String())
+			current.Reset()
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		hunks = append(hunks, current.String())
+	}
+	return hunks
+}
+
+// splitHunkLines splits a hunk into runs of lines, repeating the hunk header on every run so the model keeps its context.
+// A single line longer than the budget is cut into pieces, see cutLine.
+func splitHunkLines(file, hunk string, maxTokens int) []DiffPiece {
+	lines := strings.SplitAfter(hunk, "\n")
+	header := ""
+	if strings.HasPrefix(lines[0], "@@") {
+		header = lines[0]
+		lines = lines[1:]
+	}
+
+	// Leave room for the header and file name on every piece
+	maxChars := maxTokens*charsPerToken - len(header) - len(file) - len("File: \n\n")
+	if maxChars < charsPerToken {
+		maxChars = charsPerToken
+	}
+
+	var pieces []DiffPiece
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			pieces = append(pieces, DiffPiece{File: file, Patch: header + current.String()})
+			current.Reset()
+		}
+	}
+	for _, line := range lines {
+		if len(line) > maxChars {
+			flush()
+			cut := cutLine(line, maxChars)
+			for _, part := range cut[:len(cut)-1] {
+				current.WriteString(part)
+				flush()
+			}
+			line = cut[len(cut)-1]
+		}
+		if current.Len()+len(line) > maxChars {
+			flush()
+		}
+		current.WriteString(line)
+	}
+	flush()
+	return pieces
+}
+
+// cutLine cuts a diff line into parts of at most maxChars. Every part keeps the line's "+", "-" or " " marker and
+// all but the last end in a newline, so that each part still reads as a line of the diff. Lines are cut after
+// whitespace or, failing that, at the edge of a run of token characters, so that a secret is not split across
+// parts. A run longer than a whole part is cut at a UTF-8 character boundary.
+func cutLine(line string, maxChars int) []string {
+	marker := ""
+	if line != "" && strings.ContainsRune("+- ", rune(line[0])) {
+		marker = line[:1]
+	}
+	text := strings.TrimSuffix(line[len(marker):], "\n")
+	newline := strings.HasSuffix(line, "\n")
+	room := maxChars - len(marker) - len("\n")
+	if room < utf8.UTFMax {
+		room = utf8.UTFMax
+	}
+
+	var parts []string
+	for len(text) > room {
+		at := cutPoint(text, room)
+		parts = append(parts, marker+text[:at]+"\n")
+		text = text[at:]
+	}
+	if newline {
+		text += "\n"
+	}
+	return append(parts, marker+text)
+}
+
+// cutPoint returns where to cut a text that is longer than room, so that the part before it is at most room long.
+func cutPoint(text string, room int) int {
+	if i := strings.LastIndexAny(text[:room], " \t"); i >= 0 {
+		return i + 1
+	}
+	for at := room; at > 0; at-- {
+		if isTokenByte(text[at-1]) != isTokenByte(text[at]) {
+			return at
+		}
+	}
+	at := room
+	for at > 0 && !utf8.RuneStart(text[at]) {
+		at--
+	}
+	return at
+}
+
+// isTokenByte reports whether a byte can be part of the strings the secret detector checks, see entropyTokenPattern.
+func isTokenByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || strings.IndexByte("+/=_-.", b) >= 0
+}
+
+// packPieces greedily packs consecutive pieces into chunks of at most maxTokens estimated tokens.
+func packPieces(pieces []DiffPiece, maxTokens int) []DiffChunk {
+	var chunks []DiffChunk
+	var current DiffChunk
+	currentTokens := 0
+	for _, piece := range pieces {
+		tokens := pieceTokens(piece.File, piece.Patch)
+		if len(current.Pieces) > 0 && currentTokens+tokens > maxTokens {
+			chunks = append(chunks, current)
+			current = DiffChunk{}
+			currentTokens = 0
+		}
+		current.Pieces = append(current.Pieces, piece)
+		currentTokens += tokens
+	}
+	if len(current.Pieces) > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+// pieceTokens estimates the tokens of a piece as rendered by DiffChunk.String.
+func pieceTokens(file, patch string) int {
+	return EstimateTokens(fmt.Sprintf("File: %s\n%s\n", file, patch))
+}
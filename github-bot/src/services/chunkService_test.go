@@ -0,0 +1,146 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/google/go-github/v41/github"
+)
+
+// hunkOf returns a hunk adding the given lines.
+func hunkOf(start int, lines ...string) string {
+	return fmt.Sprintf("@@ -%d,0 +%d,%d @@\n+%s\n", start, start, len(lines), strings.Join(lines, "\n+"))
+}
+
+// assertWithin fails the test if a piece does not fit into the budget.
+func assertWithin(t *testing.T, piece DiffPiece, maxTokens int) {
+	t.Helper()
+	if tokens := pieceTokens(piece.File, piece.Patch); tokens > maxTokens {
+		t.Errorf("piece of %s has %d tokens, want at most %d:\n%s", piece.File, tokens, maxTokens, piece.Patch)
+	}
+}
+
+func TestChunkDiff(t *testing.T) {
+	small := &github.CommitFile{Filename: github.String("a.go"), Patch: github.String(hunkOf(1, "package a"))}
+	other := &github.CommitFile{Filename: github.String("b.go"), Patch: github.String(hunkOf(1, "package b"))}
+	binary := &github.CommitFile{Filename: github.String("logo.png")}
+	long := &github.CommitFile{Filename: github.String("c.go"), Patch: github.String(hunkOf(1, strings.Repeat("x", 300)) + hunkOf(50, strings.Repeat("y", 300)))}
+
+	chunks := ChunkDiff([]*github.CommitFile{small, binary, other}, 1000)
+	if len(chunks) != 1 || len(chunks[0].Pieces) != 2 {
+		t.Fatalf("got %d chunks %+v, want both small files in one chunk", len(chunks), chunks)
+	}
+	if files := chunks[0].Files(); len(files) != 2 || files[0] != "a.go" || files[1] != "b.go" {
+		t.Errorf("got files %v, want a.go and b.go", files)
+	}
+
+	chunks = ChunkDiff([]*github.CommitFile{small, long, other}, 100)
+	var patches []string
+	for _, chunk := range chunks {
+		tokens := 0
+		for _, piece := range chunk.Pieces {
+			tokens += pieceTokens(piece.File, piece.Patch)
+			patches = append(patches, piece.Patch)
+		}
+		if tokens > 100 {
+			t.Errorf("chunk %v has %d tokens, want at most 100", chunk.Files(), tokens)
+		}
+	}
+	joined := strings.Join(patches, "")
+	for _, want := range []string{"package a", strings.Repeat("x", 300), strings.Repeat("y", 300), "package b"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("the chunks lost %q", want)
+		}
+	}
+}
+
+func TestSplitPatch(t *testing.T) {
+	first, second := hunkOf(1, "one", "two"), hunkOf(20, "three", "four")
+	tests := []struct {
+		name      string
+		patch     string
+		maxTokens int
+		want      []string
+	}{
+		{"whole patch", first + second, 100, []string{first + second}},
+		{"per hunk", first + second, 15, []string{first, second}},
+		{"per line", hunkOf(1, "aaaaaaaaaa", "bbbbbbbbbb", "cccccccccc"), 15, []string{"@@ -1,0 +1,3 @@\n+aaaaaaaaaa\n+bbbbbbbbbb\n", "@@ -1,0 +1,3 @@\n+cccccccccc\n"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pieces := SplitPatch("f.go", test.patch, test.maxTokens)
+			if len(pieces) != len(test.want) {
+				t.Fatalf("got %d pieces %q, want %d", len(pieces), pieces, len(test.want))
+			}
+			for i, piece := range pieces {
+				if piece.File != "f.go" || piece.Patch != test.want[i] {
+					t.Errorf("piece %d is %q, want %q", i, piece.Patch, test.want[i])
+				}
+				assertWithin(t, piece, test.maxTokens)
+			}
+		})
+	}
+}
+
+func TestSplitPatchLongLines(t *testing.T) {
+	secret := "Zx9qL2mP8vR4tY7wK1nB5cD3fG6hJ0sA"
+	tests := []struct {
+		name string
+		line string
+		keep string // A value that must stay whole in one piece.
+	}{
+		{"words", strings.Repeat("lorem ipsum ", 12) + "key = " + secret + " " + strings.Repeat("dolor sit ", 12), secret},
+		{"minified JSON", `{"a":"` + strings.Repeat("b", 40) + `","key":"` + secret + `","c":"` + strings.Repeat("d", 40) + `"}`, secret},
+		{"multibyte characters", strings.Repeat("héllo wörld ", 20) + strings.Repeat("ü", 80), ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pieces := SplitPatch("f.js", hunkOf(1, test.line), 40)
+			if len(pieces) < 2 {
+				t.Fatalf("got %d pieces, want the line cut", len(pieces))
+			}
+			var text strings.Builder
+			kept := test.keep == ""
+			for _, piece := range pieces {
+				assertWithin(t, piece, 40)
+				if !utf8.ValidString(piece.Patch) {
+					t.Errorf("piece %q splits a UTF-8 character", piece.Patch)
+				}
+				header, body, _ := strings.Cut(piece.Patch, "\n")
+				if header != "@@ -1,0 +1,1 @@" || !strings.HasPrefix(body, "+") {
+					t.Errorf("piece %q lost its hunk header or line marker", piece.Patch)
+				}
+				kept = kept || strings.Contains(body, test.keep)
+				text.WriteString(strings.TrimSuffix(strings.TrimPrefix(body, "+"), "\n"))
+			}
+			if !kept {
+				t.Errorf("no piece contains %q whole", test.keep)
+			}
+			if text.String() != test.line {
+				t.Errorf("the pieces join to %q, want %q", text.String(), test.line)
+			}
+		})
+	}
+}
+
+func TestPackPieces(t *testing.T) {
+	piece := func(file string, chars int) DiffPiece {
+		return DiffPiece{File: file, Patch: strings.Repeat("x", chars)}
+	}
+	// Each piece is 10 tokens as rendered, "File: a\n" and a newline around 30 characters
+	pieces := []DiffPiece{piece("a", 30), piece("b", 30), piece("c", 30), piece("d", 200), piece("e", 30)}
+	chunks := packPieces(pieces, 20)
+
+	var got []string
+	for _, chunk := range chunks {
+		got = append(got, strings.Join(chunk.Files(), "+"))
+	}
+	if want := []string{"a+b", "c", "d", "e"}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got chunks %v, want %v", got, want)
+	}
+	if chunks := packPieces(nil, 20); len(chunks) != 0 {
+		t.Errorf("got %d chunks of no pieces, want none", len(chunks))
+	}
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/wenjielee1/github-bot/utils"
+)
+
+const (
+	// stickyFooterMarker separates the content of a sticky comment from its footer.
+	stickyFooterMarker = "<!-- jambu:footer -->"
+	// stickyHistoryPrefix starts each previous version kept below the footer of a sticky comment.
+	stickyHistoryPrefix = "<details><summary>Previous version"
+)
+
+// botLoginKey is the context key of the login the bot comments as.
+type botLoginKey struct{}
+
+// WithBotLogin returns a context that carries the login the bot comments as, so that it recognizes its own comments.
+func WithBotLogin(ctx context.Context, login string) context.Context {
+	return context.WithValue(ctx, botLoginKey{}, login)
+}
+
+// botLogin returns the login the bot comments as, or an empty string if the context does not carry it.
+func botLogin(ctx context.Context) string {
+	login, _ := ctx.Value(botLoginKey{}).(string)
+	return login
+}
+
+// StickyMarker returns the hidden HTML marker that identifies the comment a check owns on a pull request.
+func StickyMarker(key string) string {
+	return fmt.Sprintf("<!-- jambu:%s -->", key)
+}
+
+// UpsertStickyComment creates the comment a check owns on a pull request, or updates it in place on later pushes.
+// If someone replied since the comment was last changed, the previous content is kept in a collapsed section
+// so that the replies still make sense. Versions kept on earlier pushes are carried forward. Secrets in the
+// comment are masked.
+func UpsertStickyComment(ctx context.Context, client *github.Client, owner, repo string, number int, key, headSHA, body string) error {
+	return writeStickyComment(ctx, client, owner, repo, number, key, headSHA, body, true)
+}
+
+// UpdateStickyComment updates the comment a check owns on a pull request, if it has one. It is used when a check
+// has nothing to report anymore, so that the comment does not go stale.
+func UpdateStickyComment(ctx context.Context, client *github.Client, owner, repo string, number int, key, headSHA, body string) error {
+	return writeStickyComment(ctx, client, owner, repo, number, key, headSHA, body, false)
+}
+
+// writeStickyComment finds the comment a check owns and writes the body to it, creating it if create is set.
+func writeStickyComment(ctx context.Context, client *github.Client, owner, repo string, number int, key, headSHA, body string, create bool) error {
+	marker := StickyMarker(key)
+	body = utils.Redact(ctx, strings.TrimSpace(body))
+
+	// Find the bot's own comment with the marker, and whether anyone replied after it
+	own, replied, err := findStickyComment(ctx, client, owner, repo, number, key)
+	if err != nil {
+		return err
+	}
+
+	if own == nil {
+		if !create {
+			return nil
+		}
+		if _, _, err := client.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: github.String(stickyBody(marker, headSHA, body, ""))}); err != nil {
+			return fmt.Errorf("error commenting on #%d: %w", number, err)
+		}
+		log.Printf("Created %s comment on #%d", key, number)
+		return nil
+	}
+
+	// Leave the comment alone if its content did not change, so that it is not marked as edited on every push
+	previous := stickyContent(own.GetBody(), marker)
+	if previous == body {
+		return nil
+	}
+	// Replies before the last change refer to the versions kept then, newer versions go first
+	history := stickyHistory(own.GetBody())
+	if replied {
+		version := fmt.Sprintf("%s, which the replies below may refer to</summary>\n\n%s\n</details>", stickyHistoryPrefix, previous)
+		if history != "" {
+			version += "\n\n" + history
+		}
+		history = version
+	}
+	if _, _, err := client.Issues.EditComment(ctx, owner, repo, own.GetID(), &github.IssueComment{Body: github.String(stickyBody(marker, headSHA, body, history))}); err != nil {
+		return fmt.Errorf("error updating comment %d on #%d: %w", own.GetID(), number, err)
+	}
+	log.Printf("Updated %s comment on #%d", key, number)
+	return nil
+}
+
+// findStickyComment returns the comment a check owns on a pull request, or nil if it has none, and whether anyone
+// replied since the comment was last changed.
+func findStickyComment(ctx context.Context, client *github.Client, owner, repo string, number int, key string) (*github.IssueComment, bool, error) {
+	marker := StickyMarker(key)
+	var own *github.IssueComment
+	replied := false
+	comments, err := utils.ListAll(func(opts *github.ListOptions) ([]*github.IssueComment, *github.Response, error) {
+		return client.Issues.ListComments(ctx, owner, repo, number, &github.IssueListCommentsOptions{ListOptions: *opts})
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("error listing comments on #%d: %w", number, err)
+	}
+	for _, comment := range comments {
+		isBot := isBotUser(ctx, comment.GetUser())
+		switch {
+		case own == nil && isBot && strings.HasPrefix(comment.GetBody(), marker):
+			own = comment
+		case own != nil && !isBot && comment.GetCreatedAt().After(own.GetUpdatedAt()):
+			replied = true
+		}
+	}
+	return own, replied, nil
+}
+
+// isBotUser reports whether a user is the bot. Without the bot's login, any bot account is taken to be it.
+func isBotUser(ctx context.Context, user *github.User) bool {
+	login := botLogin(ctx)
+	return user.GetLogin() == login || (login == "" && user.GetType() == "Bot")
+}
+
+// stickyBody renders a sticky comment: the marker, the content and a footer naming the commit it is about.
+func stickyBody(marker, headSHA, content, history string) string {
+	var body strings.Builder
+	body.WriteString(marker + "\n" + content + "\n\n" + stickyFooterMarker)
+	if headSHA != "" {
+		body.WriteString(fmt.Sprintf("\n<sub>Last changed for commit %s.</sub>", headSHA))
+	}
+	if history != "" {
+		body.WriteString("\n\n" + history)
+	}
+	return body.String()
+}
+
+// stickyHistory returns the previous versions kept below the footer of a sticky comment, or an empty string if
+// it has none.
+func stickyHistory(body string) string {
+	footer := strings.Index(body, stickyFooterMarker)
+	if footer < 0 {
+		return ""
+	}
+	if i := strings.Index(body[footer:], "\n\n"+stickyHistoryPrefix); i >= 0 {
+		return body[footer+i+2:]
+	}
+	return ""
+}
+
+// stickyContent returns the content of a sticky comment without its marker and footer.
+func stickyContent(body, marker string) string {
+	content := strings.TrimPrefix(body, marker+"\n")
+	if i := strings.Index(content, "\n\n"+stickyFooterMarker); i >= 0 {
+		content = content[:i]
+	}
+	return content
+}
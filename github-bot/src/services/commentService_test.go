@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v41/github"
+)
+
+// fakeComments is the conversation of pull request #1 of o/r. Every change advances its clock by a minute.
+type fakeComments struct {
+	mu       sync.Mutex
+	now      time.Time
+	comments []*github.IssueComment
+}
+
+// tick advances the clock and returns the new time.
+func (f *fakeComments) tick() time.Time {
+	f.now = f.now.Add(time.Minute)
+	return f.now
+}
+
+// reply adds a comment by a person.
+func (f *fakeComments) reply(body string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.tick()
+	f.comments = append(f.comments, &github.IssueComment{
+		ID:        github.Int64(int64(len(f.comments) + 1)),
+		Body:      github.String(body),
+		User:      &github.User{Login: github.String("octocat"), Type: github.String("User")},
+		CreatedAt: &now,
+		UpdatedAt: &now,
+	})
+}
+
+func (f *fakeComments) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var posted github.IssueComment
+	json.NewDecoder(r.Body).Decode(&posted)
+	switch {
+	case r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(f.comments)
+	case r.Method == http.MethodPost:
+		now := f.tick()
+		posted.ID = github.Int64(int64(len(f.comments) + 1))
+		posted.User = &github.User{Login: github.String("jambu[bot]"), Type: github.String("Bot")}
+		posted.CreatedAt, posted.UpdatedAt = &now, &now
+		f.comments = append(f.comments, &posted)
+		json.NewEncoder(w).Encode(&posted)
+	case r.Method == http.MethodPatch:
+		for _, comment := range f.comments {
+			if strings.HasSuffix(r.URL.Path, "/comments/"+github.Stringify(comment.GetID())) {
+				now := f.tick()
+				comment.Body, comment.UpdatedAt = posted.Body, &now
+				json.NewEncoder(w).Encode(comment)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}
+}
+
+func TestUpsertStickyCommentKeepsHistory(t *testing.T) {
+	fake := &fakeComments{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := github.NewClient(server.Client())
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	ctx := WithBotLogin(context.Background(), "jambu[bot]")
+	upsert := func(body string) string {
+		if err := UpsertStickyComment(ctx, client, "o", "r", 1, "changelog", "abc", body); err != nil {
+			t.Fatalf("UpsertStickyComment(%q): %v", body, err)
+		}
+		return fake.comments[0].GetBody()
+	}
+
+	upsert("First version.")
+	fake.reply("Why is the first version like this?")
+	if body := upsert("Second version."); !strings.Contains(body, "First version.") {
+		t.Fatalf("got %q, want the version the reply refers to kept", body)
+	}
+	// Nobody replied to the second version, but the reply to the first one must still make sense
+	body := upsert("Third version.")
+	if !strings.Contains(body, "First version.") || strings.Contains(body, "Second version.") {
+		t.Fatalf("got %q, want only the replied-to version kept", body)
+	}
+	fake.reply("And the third?")
+	body = upsert("Fourth version.")
+	if stickyContent(body, StickyMarker("changelog")) != "Fourth version." {
+		t.Errorf("got content %q, want the fourth version", stickyContent(body, StickyMarker("changelog")))
+	}
+	third, first := strings.Index(body, "Third version."), strings.Index(body, "First version.")
+	if third < 0 || first < 0 || third > first {
+		t.Errorf("got %q, want the third and then the first version kept", body)
+	}
+	if strings.Count(body, stickyHistoryPrefix) != 2 {
+		t.Errorf("got %d kept versions, want 2", strings.Count(body, stickyHistoryPrefix))
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/wenjielee1/github-bot/models"
+	"github.com/wenjielee1/github-bot/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigPath is the path of the per-repository configuration file.
+const ConfigPath = ".github/jambubot.yml"
+
+// DefaultConfig returns the configuration used for repositories without a configuration file.
+func DefaultConfig() *models.BotConfig {
+	return &models.BotConfig{
+		Checks: models.ChecksConfig{
+			IssueLabels: true,
+			Changelog:   true,
+			Secrets:     true,
+		},
+		Labels: models.LabelsConfig{
+			Exclude:       []string{"priority"},
+			SkipIfPresent: []string{"priority", "status"},
+		},
+		Persona: models.PersonaConfig{
+			Name:     "Jambu",
+			Greeting: true,
+		},
+		Secrets: models.SecretsConfig{
+			FailOn: DefaultFailOn,
+		},
+		Diff: models.DiffConfig{
+			MaxFileBytes: DefaultMaxFileBytes,
+		},
+		Changelog: models.ChangelogConfig{
+			Path: DefaultChangelogPath,
+		},
+	}
+}
+
+// LoadRepoConfig fetches .github/jambubot.yml from the default branch of the repository and
+// merges it over the defaults. Missing or invalid files fall back to the default configuration.
+func LoadRepoConfig(ctx context.Context, client *github.Client, owner, repo string) *models.BotConfig {
+	content, found, err := utils.GetFileContent(ctx, client, owner, repo, ConfigPath, "")
+	if err != nil {
+		log.Printf("Error fetching %s from %s/%s, using defaults: %v", ConfigPath, owner, repo, err)
+		return DefaultConfig()
+	}
+	if !found {
+		log.Printf("No %s found in %s/%s, using defaults", ConfigPath, owner, repo)
+		return DefaultConfig()
+	}
+
+	config, err := ParseConfig(content)
+	if err != nil {
+		log.Printf("Error parsing %s from %s/%s, using defaults: %v", ConfigPath, owner, repo, err)
+		return DefaultConfig()
+	}
+	log.Printf("Loaded %s from %s/%s", ConfigPath, owner, repo)
+	return config
+}
+
+// ParseConfig parses the content of a configuration file over the default configuration.
+func ParseConfig(content string) (*models.BotConfig, error) {
+	config := DefaultConfig()
+	decoder := yaml.NewDecoder(strings.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error unmarshaling %s: %w", ConfigPath, err)
+	}
+	if !ValidFailOn(config.Secrets.FailOn) {
+		return nil, fmt.Errorf("error in %s: secrets.fail_on must be high, medium, low or none, not %q", ConfigPath, config.Secrets.FailOn)
+	}
+	config.Changelog.Path = strings.TrimPrefix(strings.TrimSpace(config.Changelog.Path), "/")
+	if config.Changelog.Path == "" {
+		return nil, fmt.Errorf("error in %s: changelog.path must not be empty", ConfigPath)
+	}
+	if config.Diff.MaxFileBytes < 0 {
+		return nil, fmt.Errorf("error in %s: diff.max_file_bytes must not be negative, not %d", ConfigPath, config.Diff.MaxFileBytes)
+	}
+	return config, nil
+}
+
+// FilterLabels returns the names of the labels that do not contain any of the excluded strings.
+func FilterLabels(labels []*github.Label, exclude []string) []string {
+	var names []string
+	for _, label := range labels {
+		if !containsAny(label.GetName(), exclude) {
+			names = append(names, label.GetName())
+		}
+	}
+	return names
+}
+
+// containsAny reports whether s contains any of the given substrings.
+func containsAny(s string, substrings []string) bool {
+	for _, substring := range substrings {
+		if substring != "" && strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
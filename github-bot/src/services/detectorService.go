@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/wenjielee1/github-bot/models"
+	"github.com/wenjielee1/github-bot/utils"
+)
+
+// HighEntropyRuleID is the rule ID of ambiguous high-entropy candidates, which are adjudicated by the LLM.
+const HighEntropyRuleID = "high-entropy-string"
+
+// SecretRule is a deterministic detector for one kind of secret.
+// Rule IDs are stable and used in reports, baselines and SARIF output.
+type SecretRule struct {
+	ID          string         // The stable ID of the rule.
+	Description string         // A human readable description of what the rule detects.
+	Severity    string         // The severity of a match.
+	Pattern     *regexp.Regexp // The pattern matching the secret. If it has a group, the group is the secret value.
+	Ambiguous   bool           // Whether matches are only candidates for the LLM to adjudicate.
+}
+
+// SecretRules are the built-in rules for secrets of common providers.
+var SecretRules = []SecretRule{
+	{
+		ID:          "private-key",
+		Description: "Private key",
+		Severity:    models.SeverityHigh,
+		Pattern:     regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |PGP |ENCRYPTED )?PRIVATE KEY(?: BLOCK)?-----`),
+	},
+	{
+		ID:          "aws-access-key-id",
+		Description: "AWS access key ID",
+		Severity:    models.SeverityHigh,
+		Pattern:     regexp.MustCompile(`\b((?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16})\b`),
+	},
+	{
+		ID:          "aws-secret-access-key",
+		Description: "AWS secret access key",
+		Severity:    models.SeverityHigh,
+		Pattern:     regexp.MustCompile(`(?i)aws.{0,20}(?:secret|private).{0,20}?['"=:\s]\s*['"]?([0-9a-zA-Z/+]{40})\b`),
+	},
+	{
+		ID:          "github-token",
+		Description: "GitHub token",
+		Severity:    models.SeverityHigh,
+		Pattern:     regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,255})\b`),
+	},
+	{
+		ID:          "github-fine-grained-pat",
+		Description: "GitHub fine-grained personal access token",
+		Severity:    models.SeverityHigh,
+		Pattern:     regexp.MustCompile(`\b(github_pat_[A-Za-z0-9_]{82})\b`),
+	},
+	{
+		ID:          "slack-token",
+		Description: "Slack token",
+		Severity:    models.SeverityHigh,
+		Pattern:     regexp.MustCompile(`\b(xox[abposr]-[0-9A-Za-z-]{10,})\b`),
+	},
+	{
+		ID:          "slack-webhook-url",
+		Description: "Slack incoming webhook URL",
+		Severity:    models.SeverityMedium,
+		Pattern:     regexp.MustCompile(`(https://hooks\.slack\.com/services/T[A-Z0-9]+/B[A-Z0-9]+/[A-Za-z0-9]+)`),
+	},
+	{
+		ID:          "jwt",
+		Description: "JSON Web Token",
+		Severity:    models.SeverityMedium,
+		Pattern:     regexp.MustCompile(`\b(eyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,})`),
+	},
+	{
+		ID:          "generic-secret-assignment",
+		Description: "Hardcoded password or API key",
+		Severity:    models.SeverityMedium,
+		Pattern:     regexp.MustCompile(`(?i)(?:password|passwd|pwd|secret|api[_-]?key|access[_-]?token|auth[_-]?token)["']?\s*[:=]\s*["']([^"'\s]{8,})["']`),
+		Ambiguous:   true,
+	},
+}
+
+// init masks matches of the unambiguous rules in comments and logs, even before they are detected in a diff.
+func init() {
+	for _, rule := range SecretRules {
+		if !rule.Ambiguous {
+			utils.DefaultRedactor.RegisterPattern(rule.Pattern)
+		}
+	}
+}
+
+const (
+	// minEntropyLength is the shortest string checked for high entropy.
+	minEntropyLength = 20
+	// base64EntropyThreshold is the entropy in bits per character above which a base64-like string is a candidate.
+	base64EntropyThreshold = 4.0
+	// hexEntropyThreshold is the entropy above which a hexadecimal string is a candidate.
+	hexEntropyThreshold = 3.0
+	// minHexEntropyLength is the shortest hexadecimal string checked, shorter ones are mostly hashes and colors.
+	minHexEntropyLength = 32
+)
+
+var (
+	// entropyTokenPattern matches the strings on a line that are checked for high entropy.
+	entropyTokenPattern = regexp.MustCompile(`[A-Za-z0-9+/=_\-.]{20,}`)
+	hexPattern          = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	letterPattern       = regexp.MustCompile(`[A-Za-z]`)
+	digitPattern        = regexp.MustCompile(`[0-9]`)
+)
+
+// DetectSecrets scans the lines added by a commit's files. Matches of unambiguous rules are confirmed findings,
+// matches of ambiguous rules and strings with a high Shannon entropy are candidates for the LLM to adjudicate.
+func DetectSecrets(ctx context.Context, commit string, files []*github.CommitFile) []models.SecretFinding {
+	var findings []models.SecretFinding
+	for _, file := range files {
+		if file.GetPatch() == "" {
+			continue
+		}
+		added, err := utils.AddedLines(file.GetPatch())
+		if err != nil {
+			log.Printf("Error parsing patch of %s in commit %s: %v", file.GetFilename(), commit, err)
+			continue
+		}
+		for _, line := range added {
+			for _, finding := range detectLine(commit, file.GetFilename(), line) {
+				// Mask every candidate in what this event sends from now on, whatever the LLM decides
+				utils.RegisterSecret(ctx, finding.Match)
+				finding.Fingerprint = SecretFingerprint(finding)
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return findings
+}
+
+// detectLine applies every rule and the entropy check to one added line.
+func detectLine(commit, file string, line utils.DiffLine) []models.SecretFinding {
+	var findings []models.SecretFinding
+	matched := map[string]bool{}
+	for _, rule := range SecretRules {
+		for _, match := range rule.Pattern.FindAllStringSubmatch(line.Text, -1) {
+			value := match[0]
+			if len(match) > 1 && match[1] != "" {
+				value = match[1]
+			}
+			matched[value] = true
+			findings = append(findings, models.SecretFinding{
+				RuleID:      rule.ID,
+				Description: rule.Description,
+				Severity:    rule.Severity,
+				Commit:      commit,
+				File:        file,
+				Line:        line.NewLine,
+				Match:       value,
+				Entropy:     ShannonEntropy(value),
+				Confirmed:   !rule.Ambiguous,
+			})
+		}
+	}
+
+	for _, token := range entropyTokenPattern.FindAllString(line.Text, -1) {
+		if containsMatch(matched, token) || !isHighEntropy(token) {
+			continue
+		}
+		findings = append(findings, models.SecretFinding{
+			RuleID:      HighEntropyRuleID,
+			Description: "High entropy string",
+			Severity:    models.SeverityLow,
+			Commit:      commit,
+			File:        file,
+			Line:        line.NewLine,
+			Match:       token,
+			Entropy:     ShannonEntropy(token),
+		})
+	}
+	return findings
+}
+
+// containsMatch reports whether a token overlaps a value already matched by a rule.
+func containsMatch(matched map[string]bool, token string) bool {
+	for value := range matched {
+		if strings.Contains(token, value) || strings.Contains(value, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHighEntropy reports whether a string looks random enough to be a secret.
+// Strings must mix letters and digits, which excludes long identifiers and words.
+func isHighEntropy(token string) bool {
+	if len(token) < minEntropyLength || !letterPattern.MatchString(token) || !digitPattern.MatchString(token) {
+		return false
+	}
+	if hexPattern.MatchString(token) {
+		return len(token) >= minHexEntropyLength && ShannonEntropy(token) >= hexEntropyThreshold
+	}
+	return ShannonEntropy(token) >= base64EntropyThreshold
+}
+
+// ShannonEntropy returns the Shannon entropy of a string in bits per character.
+func ShannonEntropy(value string) float64 {
+	if value == "" {
+		return 0
+	}
+	counts := map[rune]int{}
+	for _, r := range value {
+		counts[r]++
+	}
+	length := float64(len([]rune(value)))
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / length
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/wenjielee1/github-bot/models"
+	"github.com/wenjielee1/github-bot/utils"
+)
+
+const (
+	// DefaultMaxFileBytes is the largest patch sent to the LLM per file when the repository does not set one.
+	DefaultMaxFileBytes = 20000
+	// gitattributesPath is the path of the file that marks generated and vendored files.
+	gitattributesPath = ".gitattributes"
+	// maxSkippedListed is the number of skipped files listed in a note, the rest are counted.
+	maxSkippedListed = 30
+)
+
+// noisePaths are the built-in path globs of files that are never sent to the LLM, by the reason they are skipped.
+var noisePaths = []struct {
+	reason string
+	globs  []string
+}{
+	{"lockfile", []string{"go.sum", "package-lock.json", "npm-shrinkwrap.json", "yarn.lock", "pnpm-lock.yaml", "bun.lockb", "Cargo.lock", "Gemfile.lock", "poetry.lock", "Pipfile.lock", "composer.lock", "mix.lock", "pubspec.lock", "Podfile.lock", "packages.lock.json", "flake.lock"}},
+	{"vendored", []string{"vendor/", "**/vendor/", "node_modules/", "**/node_modules/", "third_party/", "**/third_party/", "bower_components/"}},
+	{"generated", []string{"*.min.js", "*.min.css", "*.map", "*.pb.go", "*_pb2.py", "*.pb.cc", "*.pb.h", "*_generated.go", "*.gen.go", "*.generated.*", "dist/", "**/dist/"}},
+	{"binary", []string{"*.png", "*.jpg", "*.jpeg", "*.gif", "*.ico", "*.webp", "*.pdf", "*.zip", "*.gz", "*.tgz", "*.jar", "*.woff", "*.woff2", "*.ttf", "*.eot", "*.exe", "*.dll", "*.so", "*.dylib", "*.wasm"}},
+}
+
+// SkippedFile is a changed file that was left out of what is sent to the LLM, or truncated.
+type SkippedFile struct {
+	File   string // The path of the file.
+	Reason string // Why it was skipped, e.g. "lockfile".
+}
+
+// gitattributesRule is a line of .gitattributes that marks paths as generated or vendored, or unmarks them.
+type gitattributesRule struct {
+	pattern string
+	noise   bool   // Whether matching files are skipped, false if the line unmarks them.
+	reason  string // Why matching files are skipped.
+}
+
+// DiffFilter decides which changed files are sent to the LLM. Files are matched, in order, against .gitattributes,
+// diff.include, diff.exclude and the built-in noise paths. Patches longer than the byte cap are truncated.
+type DiffFilter struct {
+	attributes   []gitattributesRule
+	include      []string
+	exclude      []string
+	maxFileBytes int
+}
+
+// LoadDiffFilter creates the diff filter of a repository, reading .gitattributes at the given ref. Callers pass the
+// base branch of a pull request, so that the pull request cannot change what is sent to the LLM.
+func LoadDiffFilter(ctx context.Context, client *github.Client, config *models.BotConfig, owner, repo, ref string) *DiffFilter {
+	content, _, err := utils.GetFileContent(ctx, client, owner, repo, gitattributesPath, ref)
+	if err != nil {
+		log.Printf("Error fetching %s from %s/%s, using the built-in paths only: %v", gitattributesPath, owner, repo, err)
+	}
+	return NewDiffFilter(config.Diff, content)
+}
+
+// NewDiffFilter creates a diff filter from the repository configuration and the content of .gitattributes.
+func NewDiffFilter(config models.DiffConfig, gitattributes string) *DiffFilter {
+	return &DiffFilter{
+		attributes:   parseGitattributes(gitattributes),
+		include:      config.Include,
+		exclude:      config.Exclude,
+		maxFileBytes: config.MaxFileBytes,
+	}
+}
+
+// parseGitattributes returns the lines of .gitattributes that set or unset linguist-generated or
+// linguist-vendored, or mark files as binary.
+func parseGitattributes(content string) []gitattributesRule {
+	var rules []gitattributesRule
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		for _, attribute := range fields[1:] {
+			switch attribute {
+			case "linguist-generated", "linguist-generated=true":
+				rules = append(rules, gitattributesRule{pattern: fields[0], noise: true, reason: "linguist-generated"})
+			case "linguist-vendored", "linguist-vendored=true":
+				rules = append(rules, gitattributesRule{pattern: fields[0], noise: true, reason: "linguist-vendored"})
+			case "binary", "-diff":
+				rules = append(rules, gitattributesRule{pattern: fields[0], noise: true, reason: "binary"})
+			case "-linguist-generated", "linguist-generated=false", "-linguist-vendored", "linguist-vendored=false":
+				rules = append(rules, gitattributesRule{pattern: fields[0], noise: false})
+			}
+		}
+	}
+	return rules
+}
+
+// Filter returns the files to send to the LLM and the files that were skipped or truncated.
+// Truncated files are copies, the given files are never modified.
+func (f *DiffFilter) Filter(files []*github.CommitFile) ([]*github.CommitFile, []SkippedFile) {
+	var kept []*github.CommitFile
+	var skipped []SkippedFile
+	for _, file := range files {
+		name := file.GetFilename()
+		if file.GetPatch() == "" {
+			skipped = append(skipped, SkippedFile{File: name, Reason: "no text diff"})
+			continue
+		}
+		if reason, skip := f.noise(name); skip {
+			skipped = append(skipped, SkippedFile{File: name, Reason: reason})
+			continue
+		}
+
+		if f.maxFileBytes > 0 && len(file.GetPatch()) > f.maxFileBytes {
+			truncated := *file
+			truncated.Patch = github.String(truncatePatch(file.GetPatch(), f.maxFileBytes))
+			file = &truncated
+			skipped = append(skipped, SkippedFile{File: name, Reason: fmt.Sprintf("truncated to %d bytes", f.maxFileBytes)})
+		}
+		kept = append(kept, file)
+	}
+	return kept, skipped
+}
+
+// noise reports whether a file is left out, and why.
+func (f *DiffFilter) noise(name string) (string, bool) {
+	// The last matching line of .gitattributes wins, as in git
+	for i := len(f.attributes) - 1; i >= 0; i-- {
+		if utils.MatchGlob(f.attributes[i].pattern, name) {
+			return f.attributes[i].reason + " in " + gitattributesPath, f.attributes[i].noise
+		}
+	}
+	if utils.MatchAnyGlob(f.include, name) {
+		return "", false
+	}
+	if utils.MatchAnyGlob(f.exclude, name) {
+		return "diff.exclude", true
+	}
+	for _, paths := range noisePaths {
+		if utils.MatchAnyGlob(paths.globs, name) {
+			return paths.reason, true
+		}
+	}
+	return "", false
+}
+
+// truncatePatch cuts a patch down to at most maxBytes, at the end of a line where possible.
+func truncatePatch(patch string, maxBytes int) string {
+	truncated := patch[:maxBytes]
+	if i := strings.LastIndex(truncated, "\n"); i > 0 {
+		truncated = truncated[:i]
+	}
+	return truncated
+}
+
+// FormatSkippedFiles renders the skipped files as a note for the check output, or returns an empty string if none were.
+func FormatSkippedFiles(skipped []SkippedFile) string {
+	if len(skipped) == 0 {
+		return ""
+	}
+	var note strings.Builder
+	note.WriteString("Not sent to the language model:")
+	seen := map[SkippedFile]bool{}
+	listed := 0
+	for _, file := range skipped {
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+		if listed < maxSkippedListed {
+			note.WriteString(fmt.Sprintf("\n- `%s` (%s)", file.File, file.Reason))
+		}
+		listed++
+	}
+	if listed > maxSkippedListed {
+		note.WriteString(fmt.Sprintf("\n- and %d more files", listed-maxSkippedListed))
+	}
+	return note.String()
+}
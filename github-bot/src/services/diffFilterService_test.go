@@ -0,0 +1,111 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/wenjielee1/github-bot/models"
+)
+
+func TestParseGitattributes(t *testing.T) {
+	content := `# Generated code
+*.pb.go linguist-generated
+third_party/** linguist-vendored=true text
+assets/* binary
+*.svg -diff
+api/manual.pb.go -linguist-generated
+vendor/** linguist-vendored=false
+*.go text eol=lf
+onlypattern
+`
+	want := []gitattributesRule{
+		{pattern: "*.pb.go", noise: true, reason: "linguist-generated"},
+		{pattern: "third_party/**", noise: true, reason: "linguist-vendored"},
+		{pattern: "assets/*", noise: true, reason: "binary"},
+		{pattern: "*.svg", noise: true, reason: "binary"},
+		{pattern: "api/manual.pb.go", noise: false},
+		{pattern: "vendor/**", noise: false},
+	}
+	rules := parseGitattributes(content)
+	if len(rules) != len(want) {
+		t.Fatalf("got %d rules %+v, want %d", len(rules), rules, len(want))
+	}
+	for i, rule := range rules {
+		if rule != want[i] {
+			t.Errorf("rule %d is %+v, want %+v", i, rule, want[i])
+		}
+	}
+}
+
+func TestDiffFilterNoise(t *testing.T) {
+	gitattributes := "*.pb.go linguist-generated\napi/manual.pb.go -linguist-generated\nvendor/keep/** -linguist-vendored\n"
+	filter := NewDiffFilter(models.DiffConfig{Include: []string{"dist/config.js"}, Exclude: []string{"testdata/**"}}, gitattributes)
+	tests := []struct {
+		name   string
+		want   bool
+		reason string
+	}{
+		{"main.go", false, ""},
+		{"api/service.pb.go", true, "linguist-generated in .gitattributes"},
+		{"api/manual.pb.go", false, ""},       // The last matching line wins
+		{"vendor/keep/patched.go", false, ""}, // .gitattributes unsets a built-in path
+		{"vendor/other/lib.go", true, "vendored"},
+		{"dist/config.js", false, ""}, // diff.include overrides a built-in path
+		{"dist/app.js", true, "generated"},
+		{"testdata/big.json", true, "diff.exclude"},
+		{"web/package-lock.json", true, "lockfile"},
+		{"docs/logo.png", true, "binary"},
+	}
+	for _, test := range tests {
+		reason, skip := filter.noise(test.name)
+		if skip != test.want || (skip && reason != test.reason) {
+			t.Errorf("noise(%q) = %q, %v, want %q, %v", test.name, reason, skip, test.reason, test.want)
+		}
+	}
+}
+
+func TestTruncatePatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patch    string
+		maxBytes int
+		want     string
+	}{
+		{"at a line boundary", "@@ -0,0 +1,3 @@\n+one\n+two\n+three", 24, "@@ -0,0 +1,3 @@\n+one"},
+		{"line ending exactly at the cap", "@@ -0,0 +1,2 @@\n+one\n+two", 21, "@@ -0,0 +1,2 @@\n+one"},
+		{"no line boundary", "+" + strings.Repeat("x", 20), 10, "+" + strings.Repeat("x", 9)},
+	}
+	for _, test := range tests {
+		if got := truncatePatch(test.patch, test.maxBytes); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDiffFilterFilter(t *testing.T) {
+	long := "@@ -0,0 +1,3 @@\n+one\n+two\n+three"
+	files := []*github.CommitFile{
+		{Filename: github.String("main.go"), Patch: github.String("@@ -0,0 +1 @@\n+package main")},
+		{Filename: github.String("big.go"), Patch: github.String(long)},
+		{Filename: github.String("go.sum"), Patch: github.String("@@ -0,0 +1 @@\n+h1:abc=")},
+		{Filename: github.String("logo.svg")},
+	}
+	sent, skipped := NewDiffFilter(models.DiffConfig{MaxFileBytes: 30}, "").Filter(files)
+
+	if len(sent) != 2 || sent[0].GetFilename() != "main.go" || sent[1].GetPatch() != "@@ -0,0 +1,3 @@\n+one\n+two" {
+		t.Errorf("got sent files %v, want main.go and big.go truncated", sent)
+	}
+	if files[1].GetPatch() != long {
+		t.Errorf("the given file was truncated in place")
+	}
+	want := []SkippedFile{{"big.go", "truncated to 30 bytes"}, {"go.sum", "lockfile"}, {"logo.svg", "no text diff"}}
+	if len(skipped) != len(want) {
+		t.Fatalf("got skipped %+v, want %+v", skipped, want)
+	}
+	for i := range want {
+		if skipped[i] != want[i] {
+			t.Errorf("skipped %d is %+v, want %+v", i, skipped[i], want[i])
+		}
+	}
+}
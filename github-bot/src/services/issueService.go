@@ -3,8 +3,6 @@ package services
 import (
 	"context"
 	"log"
-	"net/http"
-	"strings"
 
 	"github.com/google/go-github/v41/github"
 	"github.com/wenjielee1/github-bot/models"
@@ -13,49 +11,53 @@ import (
 
 // ProcessIssue processes a GitHub issue by adding its details to a table,
 // reading the response, and updating the issue with labels and comments.
-func ProcessIssue(ctx context.Context, client *github.Client, jamaiClient *http.Client, tableId string, owner, repo string, issue *models.Issue) {
+func ProcessIssue(ctx context.Context, client *github.Client, llm LLMProvider, config *models.BotConfig, owner, repo string, issue *models.Issue) {
 	// Create a message map with the issue title and body
 	message := map[string]string{
 		"IssueBody": issue.Title + "\n" + issue.Body,
 	}
 
-	// Add the issue details to the table and get the response
-	resp, err := AddRow(jamaiClient, models.ActionTable, tableId, message)
+	// Generate the response content for "IssueResponse" from the issue details
+	// Issues are not commented on, so an unavailable LLM only skips labelling
+	outputs, err := llm.Generate(ctx, message, "IssueResponse")
 	if err != nil {
-		log.Fatalf("Error processing issue %d %s:\n%v", issue.Number, issue.Title, err)
-	}
-
-	// Read and collect the response content for "IssueResponse"
-	respString, err := readAndCollectContent(resp, "IssueResponse")
-	if err != nil {
-		log.Fatalf("Error processing issue %d %s:\n%v", issue.Number, issue.Title, err)
+		log.Printf("Skipping labelling of issue %d %s, LLM unavailable:\n%v", issue.Number, issue.Title, err)
+		RecordError(ctx, err)
+		return
 	}
+	respString := outputs["IssueResponse"].Content
 
 	// Parse the create issue response
 	result, err := parseCreateIssueResponse(respString)
 	if err != nil {
-		log.Fatalf("Error parsing create issue response: %v", err)
+		log.Printf("Error parsing create issue response: %v", err)
+		return
 	}
 
 	// Append priority label to the result labels
 	labels := append(result.Labels, "priority: "+result.Priority)
 
-	LabelIssue(ctx, client, jamaiClient, tableId, owner, repo, issue, labels)
+	LabelIssue(ctx, client, config, owner, repo, issue, labels)
 
 	// Comment on the issue with the response. Disabled for now as of 16/7
 	// utils.CommentOnIssue(ctx, client, owner, repo, issue.Number, result.Response)
 }
 
-func LabelIssue(ctx context.Context, client *github.Client, jamaiClient *http.Client, tableId string, owner, repo string, issue *models.Issue, labels []string) {
+// LabelIssue adds the suggested labels that exist in the repository to the issue,
+// unless the issue already carries a label the repository configuration says to leave alone.
+func LabelIssue(ctx context.Context, client *github.Client, config *models.BotConfig, owner, repo string, issue *models.Issue, labels []string) {
 
-	currentLabels, _, err := client.Issues.ListLabelsByIssue(ctx, owner, repo, issue.Number, nil)
+	currentLabels, err := utils.ListAll(func(opts *github.ListOptions) ([]*github.Label, *github.Response, error) {
+		return client.Issues.ListLabelsByIssue(ctx, owner, repo, issue.Number, opts)
+	})
 	if err != nil {
-		log.Fatalf("Error retrieving labels: %v", err)
+		log.Printf("Error retrieving labels: %v", err)
+		return
 	}
 	for _, label := range currentLabels {
 
-		if strings.Contains(*label.Name, "priority") || strings.Contains(*label.Name, "status") {
-			log.Printf("Found label with prefix priority or status, skipping label: " + *label.Name)
+		if containsAny(*label.Name, config.Labels.SkipIfPresent) {
+			log.Printf("Found label matching %v, skipping label: %s", config.Labels.SkipIfPresent, *label.Name)
 			return
 		}
 	}
@@ -1,33 +1,22 @@
 package services
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/wenjielee1/github-bot/models"
+	"github.com/wenjielee1/github-bot/utils"
 )
 
-const BASE_URL = "https://api.jamaibase.com/api/v1/gen_tables"
-const MODEL_NAME = "ellm/Qwen/Qwen2.5-72B-w8a8"
-
-// Shared configuration struct for generating responses
-var GEN_CONFIG = models.GenConfig{
-	EmbeddingModel: "ellm/BAAI/bge-m3",
-	Model:          MODEL_NAME,
-	Temperature:    0.01,
-	MaxTokens:      2000,
-	TopP:           0.001,
-	RagParams: &models.RagParams{
-		K:              5,
-		RerankingModel: "ellm/BAAI/bge-reranker-v2-m3",
-	},
-}
+// jamaiBreaker is shared by every request to JamAI, so that an outage seen by one event
+// also short-circuits the others handled by the same process.
+var jamaiBreaker = utils.NewCircuitBreaker(5, time.Minute)
 
 // AuthTransport adds authentication headers to HTTP requests.
 type AuthTransport struct {
@@ -44,35 +33,41 @@ func (t *AuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 }
 
 // NewJamaiClient creates an HTTP client with authentication headers.
+// Connection and response header timeouts are set on the transport, the deadline of
+// each call is set by sendRequest so that streamed responses are not cut short.
 func NewJamaiClient(authInfo *models.JamaiAuth) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 2 * time.Minute
 	return &http.Client{
 		Transport: &AuthTransport{
-			Transport: http.DefaultTransport,
+			Transport: transport,
 			AuthInfo:  authInfo,
 		},
 	}
 }
 
 // sendRequest sends an HTTP request with the specified method, URL, and data.
-func sendRequest(client *http.Client, method, url string, data interface{}) (*http.Response, error) {
+// Transient failures are retried with backoff, see utils.DoWithRetry.
+func sendRequest(ctx context.Context, client *http.Client, method, url string, data interface{}) (*http.Response, error) {
 	body, err := json.Marshal(data)
 	if err != nil {
 		return nil, fmt.Errorf("error marshalling data: %w", err)
 	}
 
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
-	}
-
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
+	resp, err := utils.DoWithRetry(ctx, client, jamaiBreaker, utils.DefaultRetryPolicy(), func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error sending request: %w", err)
+		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusConflict {
+		defer resp.Body.Close()
 		bodyBytes, _ := ioutil.ReadAll(resp.Body)
 		return nil, fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(bodyBytes))
 	}
@@ -81,15 +76,15 @@ func sendRequest(client *http.Client, method, url string, data interface{}) (*ht
 }
 
 // CreateKnowledgeTable creates a knowledge table in JAM.AI.
-func CreateKnowledgeTable(client *http.Client, tableId string) {
-	url := fmt.Sprintf("%s/knowledge", BASE_URL)
+func CreateKnowledgeTable(ctx context.Context, client *http.Client, catalogue *ModelCatalogue, tableId string) {
+	url := fmt.Sprintf("%s/knowledge", catalogue.BaseURL)
 	data := models.CreateAgentKnowledgeTableRequest{
 		ID:             tableId,
 		Cols:           []models.Col{},
-		EmbeddingModel: GEN_CONFIG.EmbeddingModel,
+		EmbeddingModel: catalogue.EmbeddingModel,
 	}
 
-	resp, err := sendRequest(client, "POST", url, data)
+	resp, err := sendRequest(ctx, client, "POST", url, data)
 	if err != nil {
 		log.Printf("Error creating knowledge table: %v", err)
 		return
@@ -104,29 +99,22 @@ func CreateKnowledgeTable(client *http.Client, tableId string) {
 }
 
 // CreateTable creates a table in JAM.AI of the specified type.
-func CreateTable(client *http.Client, tableType models.TableType, tableId string, agents []models.Agent) {
+// If the table already exists, the generation configuration of its columns is updated instead,
+// so that changes to prompts, labels or models take effect on existing tables.
+func CreateTable(ctx context.Context, client *http.Client, catalogue *ModelCatalogue, tableType models.TableType, tableId string, agents []models.Agent) error {
 	if tableType == models.KnowledgeTable {
-		CreateKnowledgeTable(client, tableId)
-		return
+		CreateKnowledgeTable(ctx, client, catalogue, tableId)
+		return nil
 	}
 
-	url := fmt.Sprintf("%s/%s", BASE_URL, tableType)
+	url := fmt.Sprintf("%s/%s", catalogue.BaseURL, tableType)
 
 	cols := []models.Col{}
 	for _, agent := range agents {
 		col := models.Col{
-			ID:    agent.ColumnID,
-			Dtype: "str",
-		}
-		if len(agent.Messages) > 0 {
-			col.GenConfig = &models.GenConfig{
-				Model:       GEN_CONFIG.Model,
-				Messages:    agent.Messages,
-				Temperature: GEN_CONFIG.Temperature,
-				MaxTokens:   GEN_CONFIG.MaxTokens,
-				TopP:        GEN_CONFIG.TopP,
-				RagParams:   nil,
-			}
+			ID:        agent.ColumnID,
+			Dtype:     "str",
+			GenConfig: agentGenConfig(catalogue, agent),
 		}
 		cols = append(cols, col)
 	}
@@ -136,18 +124,53 @@ func CreateTable(client *http.Client, tableType models.TableType, tableId string
 		Cols: cols,
 	}
 
-	resp, err := sendRequest(client, "POST", url, data)
+	resp, err := sendRequest(ctx, client, "POST", url, data)
 	if err != nil {
-		log.Fatalf("Error creating chat table: %v", err)
-		return
+		return fmt.Errorf("error creating %s table: %w", tableType, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusConflict {
 		log.Println(tableType + " already exists.")
+		UpdateGenConfig(ctx, client, catalogue, tableType, tableId, agents)
 	} else {
 		log.Println(tableType + " created successfully.")
 	}
+	return nil
+}
+
+// UpdateGenConfig updates the generation configuration of the output columns of an existing table.
+func UpdateGenConfig(ctx context.Context, client *http.Client, catalogue *ModelCatalogue, tableType models.TableType, tableId string, agents []models.Agent) {
+	url := fmt.Sprintf("%s/%s/gen_config/update", catalogue.BaseURL, tableType)
+
+	columnMap := map[string]models.GenConfig{}
+	for _, agent := range agents {
+		if genConfig := agentGenConfig(catalogue, agent); genConfig != nil {
+			columnMap[agent.ColumnID] = *genConfig
+		}
+	}
+
+	data := models.ConfigureAgentChatTableRequest{
+		TableID:   tableId,
+		ColumnMap: columnMap,
+	}
+
+	resp, err := sendRequest(ctx, client, "POST", url, data)
+	if err != nil {
+		log.Printf("Error updating generation config of %s: %v", tableId, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	log.Printf("Generation config of %s updated successfully.", tableId)
+}
+
+// agentGenConfig returns the generation configuration of an agent's column, or nil for input columns.
+func agentGenConfig(catalogue *ModelCatalogue, agent models.Agent) *models.GenConfig {
+	if len(agent.Messages) == 0 {
+		return nil
+	}
+	return catalogue.GenConfig(agent.ColumnID, agent.Messages)
 }
 
 // NOTE: THESE COMMENTED FUNCTIONS ARE NOT TESTED, ITS JUST A ROUGH IMPLEMENTATION!
@@ -208,47 +231,10 @@ func CreateTable(client *http.Client, tableType models.TableType, tableId string
 //     }
 // }
 
-// readAndCollectContent reads the streamed response and collects content when output_column_name matches the specified column.
-func readAndCollectContent(resp *http.Response, outputColumn string) (string, error) {
+// readAndCollectColumns reads the streamed response and collects every output column, keyed by output_column_name.
+func readAndCollectColumns(resp *http.Response) (map[string]*models.ColumnResult, error) {
 	defer resp.Body.Close()
-
-	var collectedContent strings.Builder
-	scanner := bufio.NewScanner(resp.Body)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "data: ") {
-			line = strings.TrimPrefix(line, "data: ")
-			if line == "[DONE]" {
-				break
-			}
-
-			var chunk map[string]interface{}
-			if err := json.Unmarshal([]byte(line), &chunk); err != nil {
-				return "", fmt.Errorf("error unmarshaling line: %w", err)
-			}
-
-			if outputColumnName, ok := chunk["output_column_name"].(string); ok && outputColumnName == outputColumn {
-				if choices, ok := chunk["choices"].([]interface{}); ok {
-					for _, choice := range choices {
-						if choiceMap, ok := choice.(map[string]interface{}); ok {
-							if message, ok := choiceMap["message"].(map[string]interface{}); ok {
-								if content, ok := message["content"].(string); ok {
-									collectedContent.WriteString(content)
-								}
-							}
-						}
-					}
-				}
-			}
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return "", fmt.Errorf("error reading response data: %w", err)
-	}
-
-	return collectedContent.String(), nil
+	return CollectColumns(resp.Body)
 }
 
 // parseCreateIssueResponse parses the response content into a CreateIssueResponse.
@@ -261,18 +247,18 @@ func parseCreateIssueResponse(content string) (models.CreateIssueResponse, error
 }
 
 // AddRow adds a row to the specified table in JAM.AI.
-func AddRow(client *http.Client, tableType models.TableType, tableId string, messages map[string]string) (*http.Response, error) {
-	url := fmt.Sprintf("%s/%s/rows/add", BASE_URL, tableType)
+func AddRow(ctx context.Context, client *http.Client, catalogue *ModelCatalogue, tableType models.TableType, tableId string, messages map[string]string) (*http.Response, error) {
+	url := fmt.Sprintf("%s/%s/rows/add", catalogue.BaseURL, tableType)
 	data := models.AddRowRequest{
 		TableID: tableId,
 		Data:    []map[string]string{messages},
 		Stream:  true,
 	}
 
-	resp, err := sendRequest(client, "POST", url, data)
+	resp, err := sendRequest(ctx, client, "POST", url, data)
 	if err != nil {
 		log.Printf("Error generating text during interaction: %v", err)
-		return nil, fmt.Errorf("error marshaling data: %w", err)
+		return nil, fmt.Errorf("error adding row to %s: %w", tableId, err)
 	}
 
 	return resp, nil
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/wenjielee1/github-bot/models"
+)
+
+// Names of the supported LLM providers, as used in the llm.provider configuration key.
+const (
+	JamaiProviderName  = "jamai"
+	OpenAIProviderName = "openai"
+)
+
+// Names of the bot's checks, as used in usage reports.
+const (
+	IssueCheck     = "issue"
+	ChangelogCheck = "changelog"
+	SecretsCheck   = "secrets"
+)
+
+// CheckForColumn returns the name of the check that owns an output column of the action table.
+func CheckForColumn(columnID string) string {
+	switch columnID {
+	case "IssueResponse":
+		return IssueCheck
+	case "PullReqResponse":
+		return ChangelogCheck
+	case "PullReqSecretsResponse", "SecretsJSONResponse":
+		return SecretsCheck
+	}
+	return "other"
+}
+
+// LLMProvider generates the responses of the bot's checks. Each check fills in the input columns
+// of the action table (e.g. "IssueBody") and reads back the output columns it needs (e.g. "IssueResponse").
+type LLMProvider interface {
+	// Setup prepares the provider to generate the given agents' columns.
+	Setup(ctx context.Context, agents []models.Agent) error
+	// Generate fills in the input columns and generates at least the requested output columns. It returns the
+	// content and token usage of every column it generated, which may include columns that were not requested.
+	Generate(ctx context.Context, inputs map[string]string, outputColumns ...string) (map[string]models.ColumnResult, error)
+}
+
+// NewLLMProvider creates the LLM provider selected in the repository configuration.
+func NewLLMProvider(config *models.BotConfig, tableId string) (LLMProvider, error) {
+	catalogue := LoadModelCatalogue(config)
+	switch config.LLM.Provider {
+	case "", JamaiProviderName:
+		auth, err := GetJamAiHeader()
+		if err != nil {
+			return nil, err
+		}
+		return NewJamaiProvider(NewJamaiClient(auth), catalogue, tableId), nil
+	case OpenAIProviderName:
+		return NewOpenAIProvider(catalogue, config.LLM.Model)
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", config.LLM.Provider)
+	}
+}
+
+// JamaiProvider generates responses through a JamAIBase action table, where every output column
+// is generated server-side from the input columns of the row.
+type JamaiProvider struct {
+	client    *http.Client
+	catalogue *ModelCatalogue
+	tableId   string
+}
+
+// NewJamaiProvider creates a provider backed by the action table with the given ID.
+func NewJamaiProvider(client *http.Client, catalogue *ModelCatalogue, tableId string) *JamaiProvider {
+	return &JamaiProvider{client: client, catalogue: catalogue, tableId: tableId}
+}
+
+// Setup creates the action table, or updates its generation configuration if it already exists.
+func (p *JamaiProvider) Setup(ctx context.Context, agents []models.Agent) error {
+	return CreateTable(ctx, p.client, p.catalogue, models.ActionTable, p.tableId, agents)
+}
+
+// Generate adds a row with the input columns to the action table and collects every output column of the row.
+func (p *JamaiProvider) Generate(ctx context.Context, inputs map[string]string, outputColumns ...string) (map[string]models.ColumnResult, error) {
+	resp, err := AddRow(ctx, p.client, p.catalogue, models.ActionTable, p.tableId, inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := readAndCollectColumns(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make(map[string]models.ColumnResult, len(results))
+	for column, result := range results {
+		outputs[column] = *result
+	}
+	for _, column := range outputColumns {
+		if _, ok := outputs[column]; !ok {
+			return nil, fmt.Errorf("response did not contain column %s", column)
+		}
+	}
+	return outputs, nil
+}
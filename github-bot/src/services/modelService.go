@@ -0,0 +1,168 @@
+package services
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/wenjielee1/github-bot/models"
+)
+
+// Defaults used when neither the environment nor the repository configuration set a value.
+const (
+	defaultJamaiBaseURL   = "https://api.jamaibase.com/api/v1/gen_tables"
+	defaultModel          = "ellm/Qwen/Qwen2.5-72B-w8a8"
+	defaultEmbeddingModel = "ellm/BAAI/bge-m3"
+)
+
+// ModelCatalogue holds the JamAI endpoint and the generation settings of every output column of the action table.
+//
+// Settings are resolved from lowest to highest precedence:
+//   - the built-in defaults,
+//   - TRIAGE_BOT_JAMAI_MODEL, TRIAGE_BOT_JAMAI_TEMPERATURE, TRIAGE_BOT_JAMAI_MAX_TOKENS and TRIAGE_BOT_JAMAI_TOP_P,
+//   - the same variables for a single column, e.g. TRIAGE_BOT_JAMAI_ISSUE_RESPONSE_MODEL,
+//   - the models section of the repository configuration, per check and then per column.
+//
+// The base URL is only read from TRIAGE_BOT_JAMAI_BASE_URL, so that a repository cannot
+// send the operator's JamAI key to another host.
+type ModelCatalogue struct {
+	BaseURL        string           // The gen_tables endpoint of the JamAI deployment.
+	EmbeddingModel string           // The embedding model used for knowledge tables.
+	Defaults       models.GenConfig // The operator's generation settings shared by every column.
+
+	repoModels models.ModelsConfig
+}
+
+// LoadModelCatalogue builds the model catalogue from the environment and the repository configuration.
+func LoadModelCatalogue(config *models.BotConfig) *ModelCatalogue {
+	catalogue := &ModelCatalogue{
+		BaseURL:        strings.TrimSuffix(getEnvString("TRIAGE_BOT_JAMAI_BASE_URL", defaultJamaiBaseURL), "/"),
+		EmbeddingModel: getEnvString("TRIAGE_BOT_JAMAI_EMBEDDING_MODEL", defaultEmbeddingModel),
+		Defaults: models.GenConfig{
+			Model:       defaultModel,
+			Temperature: 0.01,
+			MaxTokens:   2000,
+			TopP:        0.001,
+		},
+	}
+	applyEnvGenConfig(&catalogue.Defaults, "TRIAGE_BOT_JAMAI_")
+
+	if config != nil {
+		catalogue.repoModels = config.Models
+		if config.Models.Embedding != "" {
+			catalogue.EmbeddingModel = config.Models.Embedding
+		}
+	}
+	return catalogue
+}
+
+// GenConfig returns the generation configuration of an output column with the given prompt messages.
+func (c *ModelCatalogue) GenConfig(columnID string, messages []models.Message) *models.GenConfig {
+	genConfig := c.Defaults
+	genConfig.Messages = messages
+	genConfig.RagParams = nil
+
+	// Operator defaults for this column
+	applyEnvGenConfig(&genConfig, "TRIAGE_BOT_JAMAI_"+envColumnName(columnID)+"_")
+
+	// Repository model for every check, then for the check that owns the column
+	if c.repoModels.Default != "" {
+		genConfig.Model = c.repoModels.Default
+	}
+	if model := c.checkModel(CheckForColumn(columnID)); model != "" {
+		genConfig.Model = model
+	}
+
+	// Repository settings for this column
+	if column, ok := c.repoModels.Columns[columnID]; ok {
+		if column.Model != "" {
+			genConfig.Model = column.Model
+		}
+		if column.Temperature != nil {
+			genConfig.Temperature = *column.Temperature
+		}
+		if column.MaxTokens > 0 {
+			genConfig.MaxTokens = column.MaxTokens
+		}
+		if column.TopP != nil {
+			genConfig.TopP = *column.TopP
+		}
+	}
+	return &genConfig
+}
+
+// checkModel returns the repository's model for a check, if any.
+func (c *ModelCatalogue) checkModel(check string) string {
+	switch check {
+	case IssueCheck:
+		return c.repoModels.Issue
+	case ChangelogCheck:
+		return c.repoModels.Changelog
+	case SecretsCheck:
+		return c.repoModels.Secrets
+	}
+	return ""
+}
+
+// applyEnvGenConfig overrides generation settings from the environment variables with the given prefix.
+func applyEnvGenConfig(genConfig *models.GenConfig, prefix string) {
+	genConfig.Model = getEnvString(prefix+"MODEL", genConfig.Model)
+	genConfig.Temperature = getEnvFloat(prefix+"TEMPERATURE", genConfig.Temperature)
+	genConfig.MaxTokens = getEnvInt(prefix+"MAX_TOKENS", genConfig.MaxTokens)
+	genConfig.TopP = getEnvFloat(prefix+"TOP_P", genConfig.TopP)
+}
+
+// envColumnName converts a column ID to its environment variable form, e.g. "SecretsJSONResponse" to "SECRETS_JSON_RESPONSE".
+func envColumnName(columnID string) string {
+	runes := []rune(columnID)
+	var name strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			previousLower := unicode.IsLower(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if previousLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				name.WriteRune('_')
+			}
+		}
+		name.WriteRune(unicode.ToUpper(r))
+	}
+	return name.String()
+}
+
+// getEnvString returns the value of an environment variable, or the default value if it is unset or empty.
+func getEnvString(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvFloat returns the float value of an environment variable, or the default value if it is unset or invalid.
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Error parsing %s, using %v: %v", key, defaultValue, err)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvInt returns the integer value of an environment variable, or the default value if it is unset or invalid.
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Error parsing %s, using %v: %v", key, defaultValue, err)
+		return defaultValue
+	}
+	return parsed
+}
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/wenjielee1/github-bot/models"
+	"github.com/wenjielee1/github-bot/utils"
+)
+
+// Names of the secret notifiers, as used in the secrets.notifiers list of the repository configuration.
+const (
+	CheckRunNotifierName = "check_run"
+	WebhookNotifierName  = "webhook"
+	AdvisoryNotifierName = "advisory"
+	CommentNotifierName  = "comment"
+	ReviewNotifierName   = "review"
+)
+
+// webhookBreaker stops delivering to the security webhook for a while after repeated failures.
+var webhookBreaker = utils.NewCircuitBreaker(5, time.Minute)
+
+// SecretNotifier delivers the details of secret findings to the people who need to act on them,
+// away from the public pull request conversation.
+type SecretNotifier interface {
+	// Name returns the name of the notifier, used in logs.
+	Name() string
+	// Notify delivers the findings of a pull request.
+	Notify(ctx context.Context, report *models.SecretReport) error
+}
+
+// NewSecretNotifiers creates the notifiers selected in the repository configuration. Without a selection,
+// findings go to a check run, and to the security webhook as well if the operator configured one.
+// The check_run notifier completes the check run of the secret check, if it has one.
+func NewSecretNotifiers(config *models.BotConfig, client *github.Client, check *CheckReport) []SecretNotifier {
+	webhookURL := os.Getenv("TRIAGE_BOT_SECRETS_WEBHOOK_URL")
+	names := config.Secrets.Notifiers
+	if len(names) == 0 {
+		names = []string{CheckRunNotifierName}
+		if webhookURL != "" {
+			names = append(names, WebhookNotifierName)
+		}
+	}
+
+	var notifiers []SecretNotifier
+	for _, name := range names {
+		switch name {
+		case CheckRunNotifierName:
+			notifiers = append(notifiers, &CheckRunNotifier{Client: client, Check: check, FailOn: config.Secrets.FailOn})
+		case WebhookNotifierName:
+			if webhookURL == "" {
+				log.Printf("Error: secret notifier %q needs TRIAGE_BOT_SECRETS_WEBHOOK_URL, skipping it", name)
+				continue
+			}
+			notifiers = append(notifiers, NewWebhookNotifier(webhookURL, os.Getenv("TRIAGE_BOT_SECRETS_WEBHOOK_SECRET")))
+		case AdvisoryNotifierName:
+			notifiers = append(notifiers, &AdvisoryNotifier{Client: client})
+		case CommentNotifierName:
+			notifiers = append(notifiers, &CommentNotifier{Client: client})
+		case ReviewNotifierName:
+			notifiers = append(notifiers, &ReviewNotifier{Client: client})
+		default:
+			log.Printf("Error: unknown secret notifier %q, skipping it", name)
+		}
+	}
+	return notifiers
+}
+
+// NotifySecretFindings sends the report to every notifier and returns the number of notifiers that delivered it.
+func NotifySecretFindings(ctx context.Context, notifiers []SecretNotifier, report *models.SecretReport) int {
+	delivered := 0
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(ctx, report); err != nil {
+			log.Printf("Error sending secret findings of %s/%s#%d to %s: %v", report.Owner, report.Repo, report.PullRequest, notifier.Name(), err)
+			continue
+		}
+		delivered++
+	}
+	return delivered
+}
+
+// FormatSecretReport renders the findings of a report as markdown, grouped by commit.
+// Matched values are never included, only their location and the rule that matched.
+func FormatSecretReport(report *models.SecretReport) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Possible secrets were added in pull request #%d of %s/%s:\n", report.PullRequest, report.Owner, report.Repo))
+	commit := ""
+	explained := map[string]bool{}
+	for _, finding := range report.Findings {
+		if finding.Commit != commit {
+			commit = finding.Commit
+			text.WriteString(fmt.Sprintf("\nCommit %s:\n", commit))
+		}
+		text.WriteString(fmt.Sprintf("- `%s` line %d: %s (`%s`, %s severity)\n", finding.File, finding.Line, finding.Description, finding.RuleID, finding.Severity))
+	}
+	for _, finding := range report.Findings {
+		if finding.Explanation != "" && !explained[finding.Explanation] {
+			explained[finding.Explanation] = true
+			text.WriteString("\n" + finding.Explanation + "\n")
+		}
+	}
+	text.WriteString(fmt.Sprintf("\nRotate any real credential, then remove it from the history of the branch. Accept false positives in `%s`.\n", SecretsBaselinePath))
+	return text.String()
+}
+
+// highestSeverity returns the most severe severity among the findings.
+func highestSeverity(findings []models.SecretFinding) string {
+	severity := models.SeverityLow
+	for _, finding := range findings {
+		switch {
+		case finding.Severity == models.SeverityHigh:
+			return models.SeverityHigh
+		case finding.Severity == models.SeverityMedium:
+			severity = models.SeverityMedium
+		}
+	}
+	return severity
+}
+
+// CheckRunNotifier reports findings in the check run of the secret check, with an annotation on every finding's
+// line. If the check has no check run, a completed one is created on the pull request's head commit.
+// The details only show up in the checks tab.
+type CheckRunNotifier struct {
+	Client *github.Client
+	Check  *CheckReport // The report of the secret check, if any.
+	FailOn string       // The severity threshold of findings that fail the check run.
+}
+
+// Name returns the name of the notifier.
+func (n *CheckRunNotifier) Name() string {
+	return CheckRunNotifierName
+}
+
+// Notify completes or creates the check run.
+func (n *CheckRunNotifier) Notify(ctx context.Context, report *models.SecretReport) error {
+	var annotations []*github.CheckRunAnnotation
+	for _, finding := range report.Findings {
+		annotations = append(annotations, &github.CheckRunAnnotation{
+			Path:            github.String(finding.File),
+			StartLine:       github.Int(finding.Line),
+			EndLine:         github.Int(finding.Line),
+			AnnotationLevel: github.String("failure"),
+			Title:           github.String(finding.Description),
+			Message:         github.String(utils.Redact(ctx, fmt.Sprintf("Possible secret added in commit %s (%s).", finding.Commit, finding.RuleID))),
+		})
+	}
+	title := fmt.Sprintf("%d possible secrets found", len(report.Findings))
+	conclusion := secretsConclusion(n.FailOn, report.Findings)
+
+	if n.Check != nil && n.Check.HasCheckRun() {
+		n.Check.Complete(ctx, conclusion, title, FormatSecretReport(report), annotations)
+		return nil
+	}
+
+	if len(annotations) > maxCheckRunAnnotations {
+		annotations = annotations[:maxCheckRunAnnotations]
+	}
+	_, _, err := n.Client.Checks.CreateCheckRun(ctx, report.Owner, report.Repo, github.CreateCheckRunOptions{
+		Name:        SecretsCheckRunName,
+		HeadSHA:     report.HeadSHA,
+		Status:      github.String("completed"),
+		Conclusion:  github.String(conclusion),
+		CompletedAt: &github.Timestamp{Time: time.Now()},
+		Output: &github.CheckRunOutput{
+			Title:       github.String(title),
+			Summary:     github.String(utils.Redact(ctx, FormatSecretReport(report))),
+			Annotations: annotations,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error creating check run: %w", err)
+	}
+	return nil
+}
+
+// WebhookNotifier posts findings as JSON to a private webhook, such as a security team's incident channel.
+// Deliveries are signed like GitHub's in the X-Jambu-Signature-256 header if a secret is configured.
+type WebhookNotifier struct {
+	URL    string            // The URL the report is posted to.
+	Secret string            // The secret deliveries are signed with, if any.
+	Client *http.Client      // The HTTP client deliveries are sent with.
+	Policy utils.RetryPolicy // How deliveries are retried.
+}
+
+// NewWebhookNotifier creates a webhook notifier with the default HTTP client and retry policy.
+func NewWebhookNotifier(url, secret string) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:    url,
+		Secret: secret,
+		Client: http.DefaultClient,
+		Policy: utils.RetryPolicy{
+			MaxAttempts: 3,
+			BaseDelay:   time.Second,
+			MaxDelay:    10 * time.Second,
+			Timeout:     30 * time.Second,
+		},
+	}
+}
+
+// Name returns the name of the notifier.
+func (n *WebhookNotifier) Name() string {
+	return WebhookNotifierName
+}
+
+// Notify posts the report, with detected secrets masked.
+func (n *WebhookNotifier) Notify(ctx context.Context, report *models.SecretReport) error {
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("error marshalling secret report: %w", err)
+	}
+	// The LLM's explanations may quote the secret, masking keeps the JSON valid as it only replaces characters
+	payload = []byte(utils.Redact(ctx, string(payload)))
+
+	resp, err := utils.DoWithRetry(ctx, n.Client, webhookBreaker, n.Policy, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Jambu-Event", "secret_findings")
+		if n.Secret != "" {
+			req.Header.Set("X-Jambu-Signature-256", utils.SignWebhookPayload(payload, n.Secret))
+		}
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
+
+// AdvisoryNotifier drafts a repository security advisory, which only the repository's administrators
+// and security managers can see.
+type AdvisoryNotifier struct {
+	Client *github.Client
+}
+
+// Name returns the name of the notifier.
+func (n *AdvisoryNotifier) Name() string {
+	return AdvisoryNotifierName
+}
+
+// Notify creates the draft advisory.
+func (n *AdvisoryNotifier) Notify(ctx context.Context, report *models.SecretReport) error {
+	// go-github does not cover repository advisories yet, so the request is built by hand
+	advisory := map[string]interface{}{
+		"summary":         fmt.Sprintf("Possible secrets added in pull request #%d", report.PullRequest),
+		"description":     utils.Redact(ctx, FormatSecretReport(report)),
+		"severity":        highestSeverity(report.Findings),
+		"cwe_ids":         []string{"CWE-798"},
+		"vulnerabilities": []interface{}{},
+	}
+	req, err := n.Client.NewRequest(http.MethodPost, fmt.Sprintf("repos/%s/%s/security-advisories", report.Owner, report.Repo), advisory)
+	if err != nil {
+		return fmt.Errorf("error creating advisory request: %w", err)
+	}
+	if _, err := n.Client.Do(ctx, req, nil); err != nil {
+		return fmt.Errorf("error creating security advisory: %w", err)
+	}
+	return nil
+}
+
+// CommentNotifier posts the findings as a sticky comment on the pull request, updated on later pushes.
+// Only suitable for private repositories.
+type CommentNotifier struct {
+	Client *github.Client
+}
+
+// Name returns the name of the notifier.
+func (n *CommentNotifier) Name() string {
+	return CommentNotifierName
+}
+
+// Notify posts or updates the comment.
+func (n *CommentNotifier) Notify(ctx context.Context, report *models.SecretReport) error {
+	return UpsertStickyComment(ctx, n.Client, report.Owner, report.Repo, report.PullRequest, "secrets-details", report.HeadSHA, "Jambo! "+FormatSecretReport(report))
+}
+
+// ReviewNotifier posts the findings as a pull request review with an inline comment on every finding's line.
+// Only suitable for private repositories.
+type ReviewNotifier struct {
+	Client *github.Client
+}
+
+// Name returns the name of the notifier.
+func (n *ReviewNotifier) Name() string {
+	return ReviewNotifierName
+}
+
+// Notify submits the review.
+func (n *ReviewNotifier) Notify(ctx context.Context, report *models.SecretReport) error {
+	// The positions of the comments are looked up in the diff of the whole pull request
+	pr := &models.PullRequest{Number: report.PullRequest}
+	pr.Head.SHA = report.HeadSHA
+	files, err := ListPullRequestFiles(ctx, n.Client, report.Owner, report.Repo, pr)
+	if err != nil {
+		return err
+	}
+
+	var comments []models.ReviewComment
+	for _, finding := range report.Findings {
+		body := fmt.Sprintf("Possible secret: %s (`%s`, %s severity), added in commit %s.", finding.Description, finding.RuleID, finding.Severity, finding.Commit)
+		if finding.Explanation != "" {
+			body += "\n\n" + finding.Explanation
+		}
+		comments = append(comments, models.ReviewComment{File: finding.File, Line: finding.Line, Body: body})
+	}
+	body := fmt.Sprintf("Jambo! I found %d possible secrets in this pull request. Rotate any real credential, then remove it from the history of the branch. Accept false positives in `%s`.", len(report.Findings), SecretsBaselinePath)
+
+	return SubmitReview(ctx, n.Client, report.Owner, report.Repo, pr, files, body, comments)
+}
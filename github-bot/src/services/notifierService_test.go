@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wenjielee1/github-bot/models"
+	"github.com/wenjielee1/github-bot/utils"
+)
+
+// testWebhookNotifier creates a webhook notifier for a local server that retries quickly.
+func testWebhookNotifier(server *httptest.Server) *WebhookNotifier {
+	notifier := NewWebhookNotifier(server.URL, "webhook-secret")
+	notifier.Client = server.Client()
+	notifier.Policy = utils.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, Timeout: time.Second}
+	return notifier
+}
+
+func TestWebhookNotifierRedactsPayload(t *testing.T) {
+	const secret = "s3cr3t-Value-From-The-Diff"
+	ctx := utils.WithRedactor(context.Background())
+	utils.RegisterSecret(ctx, secret)
+
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get("X-Jambu-Signature-256")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	report := &models.SecretReport{Owner: "o", Repo: "r", PullRequest: 1, HeadSHA: "abc", Findings: []models.SecretFinding{{
+		RuleID:      "password-assignment",
+		File:        "config.py",
+		Line:        3,
+		Match:       secret,
+		Confirmed:   true,
+		Explanation: "The password " + secret + " is hardcoded.",
+	}}}
+	if err := testWebhookNotifier(server).Notify(ctx, report); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	if strings.Contains(string(body), secret) {
+		t.Errorf("payload contains the secret: %s", body)
+	}
+	var received models.SecretReport
+	if err := json.Unmarshal(body, &received); err != nil {
+		t.Fatalf("payload is not valid JSON after masking: %v", err)
+	}
+	if len(received.Findings) != 1 || received.Findings[0].File != "config.py" {
+		t.Errorf("unexpected findings in payload: %+v", received.Findings)
+	}
+	if err := utils.VerifyWebhookSignature(body, signature, "webhook-secret"); err != nil {
+		t.Errorf("signature does not match the delivered payload: %v", err)
+	}
+}
+
+func TestWebhookNotifierStatusCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		wantErr  bool
+		attempts int
+	}{
+		{"accepted", []int{http.StatusOK}, false, 1},
+		{"rejected", []int{http.StatusBadRequest}, true, 1},
+		{"server error", []int{http.StatusInternalServerError}, true, 1},
+		{"retried after unavailable", []int{http.StatusServiceUnavailable, http.StatusAccepted}, false, 2},
+		{"unavailable on every attempt", []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable}, true, 2},
+	}
+	for _, test := range tests {
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.statuses[attempts])
+			attempts++
+		}))
+		err := testWebhookNotifier(server).Notify(context.Background(), &models.SecretReport{Owner: "o", Repo: "r"})
+		server.Close()
+
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want error %v", test.name, err, test.wantErr)
+		}
+		if attempts != test.attempts {
+			t.Errorf("%s: got %d attempts, want %d", test.name, attempts, test.attempts)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wenjielee1/github-bot/models"
+	"github.com/wenjielee1/github-bot/utils"
+)
+
+// openaiBreaker is shared by every request to the OpenAI-compatible server.
+var openaiBreaker = utils.NewCircuitBreaker(5, time.Minute)
+
+// columnReference matches the ${Column} placeholders used in the column prompts.
+var columnReference = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// OpenAIProvider generates responses through an OpenAI-compatible chat completions endpoint,
+// such as a local llama.cpp, vLLM or Ollama server. It evaluates the action table locally:
+// every output column is one chat completion whose prompts have their ${Column} placeholders
+// replaced with the inputs and previously generated columns.
+type OpenAIProvider struct {
+	baseURL   string
+	apiKey    string
+	model     string
+	catalogue *ModelCatalogue
+	client    *http.Client
+	agents    map[string]models.Agent
+}
+
+// NewOpenAIProvider creates a provider for the endpoint in TRIAGE_BOT_OPENAI_BASE_URL, authenticating with
+// TRIAGE_BOT_OPENAI_API_KEY if set. The model is taken from the repository configuration, then from
+// TRIAGE_BOT_OPENAI_MODEL, and otherwise from the model catalogue for each column. The remaining
+// generation settings of each column always come from the model catalogue.
+func NewOpenAIProvider(catalogue *ModelCatalogue, model string) (*OpenAIProvider, error) {
+	baseURL := os.Getenv("TRIAGE_BOT_OPENAI_BASE_URL")
+	if baseURL == "" {
+		return nil, fmt.Errorf("TRIAGE_BOT_OPENAI_BASE_URL environment variable not set")
+	}
+	if model == "" {
+		model = os.Getenv("TRIAGE_BOT_OPENAI_MODEL")
+	}
+
+	return &OpenAIProvider{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		apiKey:    os.Getenv("TRIAGE_BOT_OPENAI_API_KEY"),
+		model:     model,
+		catalogue: catalogue,
+		client:    &http.Client{},
+		agents:    map[string]models.Agent{},
+	}, nil
+}
+
+// Setup records the agents whose columns the provider generates.
+func (p *OpenAIProvider) Setup(ctx context.Context, agents []models.Agent) error {
+	for _, agent := range agents {
+		p.agents[agent.ColumnID] = agent
+	}
+	return nil
+}
+
+// Generate generates each requested output column, generating any output columns it depends on first.
+func (p *OpenAIProvider) Generate(ctx context.Context, inputs map[string]string, outputColumns ...string) (map[string]models.ColumnResult, error) {
+	values := make(map[string]string, len(inputs))
+	for column, value := range inputs {
+		values[column] = value
+	}
+
+	outputs := map[string]models.ColumnResult{}
+	for _, column := range outputColumns {
+		if err := p.generateColumn(ctx, column, values, outputs, map[string]bool{}); err != nil {
+			return nil, err
+		}
+	}
+	return outputs, nil
+}
+
+// generateColumn generates a single output column into values and outputs, resolving the columns its prompts reference.
+// The visiting set guards against prompts that reference each other.
+func (p *OpenAIProvider) generateColumn(ctx context.Context, column string, values map[string]string, outputs map[string]models.ColumnResult, visiting map[string]bool) error {
+	if _, ok := values[column]; ok {
+		return nil
+	}
+	agent, ok := p.agents[column]
+	if !ok || len(agent.Messages) == 0 {
+		return fmt.Errorf("no value or prompt for column %s", column)
+	}
+	if visiting[column] {
+		return fmt.Errorf("column %s references itself", column)
+	}
+	visiting[column] = true
+
+	// Generate the columns referenced by the prompts and fill in their values
+	messages := make([]models.Message, 0, len(agent.Messages))
+	for _, message := range agent.Messages {
+		for _, match := range columnReference.FindAllStringSubmatch(message.Content, -1) {
+			if err := p.generateColumn(ctx, match[1], values, outputs, visiting); err != nil {
+				return err
+			}
+		}
+		content := columnReference.ReplaceAllStringFunc(message.Content, func(reference string) string {
+			return values[columnReference.FindStringSubmatch(reference)[1]]
+		})
+		messages = append(messages, models.Message{Role: message.Role, Content: content})
+	}
+
+	genConfig := p.catalogue.GenConfig(column, messages)
+	if p.model != "" {
+		genConfig.Model = p.model
+	}
+	content, usage, err := p.complete(ctx, models.ChatCompletionRequest{
+		Model:       genConfig.Model,
+		Messages:    genConfig.Messages,
+		Temperature: genConfig.Temperature,
+		MaxTokens:   genConfig.MaxTokens,
+		TopP:        genConfig.TopP,
+	})
+	if err != nil {
+		return fmt.Errorf("error generating column %s: %w", column, err)
+	}
+	values[column] = content
+	outputs[column] = models.ColumnResult{Content: content, Usage: usage}
+	return nil
+}
+
+// complete sends a chat completion request and returns the content of the first choice and the token usage.
+func (p *OpenAIProvider) complete(ctx context.Context, data models.ChatCompletionRequest) (string, models.Usage, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return "", models.Usage{}, fmt.Errorf("error marshalling data: %w", err)
+	}
+
+	resp, err := utils.DoWithRetry(ctx, p.client, openaiBreaker, utils.DefaultRetryPolicy(), func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewBuffer(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", "application/json")
+		if p.apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+p.apiKey)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return "", models.Usage{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		return "", models.Usage{}, fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var completion models.ChatCompletionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return "", models.Usage{}, fmt.Errorf("error unmarshaling chat completion: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", models.Usage{}, fmt.Errorf("chat completion returned no choices")
+	}
+	log.Printf("Generated %d completion tokens with %s", completion.Usage.CompletionTokens, completion.Model)
+	return completion.Choices[0].Message.Content, completion.Usage, nil
+}
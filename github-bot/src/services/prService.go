@@ -3,7 +3,9 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strings"
@@ -13,85 +15,288 @@ import (
 	"github.com/wenjielee1/github-bot/utils"
 )
 
-// CheckChangelogUpdated checks if the CHANGELOG.md file is updated in the pull request and provides suggestions if not.
-func CheckChangelogUpdated(ctx context.Context, client *github.Client, jamaiClient *http.Client, owner, repo string, pr *models.PullRequest) {
+// CheckChangelogUpdated checks if the pull request adds a well-formed entry to the repository's changelog, CHANGELOG.md
+// unless changelog.path says otherwise. The added lines are validated against the Keep a Changelog sections, and
+// only a missing or malformed entry makes the check ask the LLM for the [Unreleased] section with an entry for the
+// pull request. The section is posted as a suggestion on the changelog if it is part of the diff, and can otherwise
+// be committed with the apply-changelog command. The outcome is reported in the JambuBot changelog check run, which
+// fails unless the entry is well-formed. Lockfiles, vendored, generated and binary files are left out of the prompt,
+// and long patches are truncated.
+func CheckChangelogUpdated(ctx context.Context, client *github.Client, llm LLMProvider, config *models.BotConfig, owner, repo string, pr *models.PullRequest) {
+	check := StartCheckReport(ctx, client, owner, repo, pr, ChangelogCheckName)
+	path := config.Changelog.Path
+
 	// List the files changed in the pull request
-	files, _, err := client.PullRequests.ListFiles(ctx, owner, repo, pr.Number, nil)
+	files, err := ListPullRequestFiles(ctx, client, owner, repo, pr)
 
 	if err != nil {
 		log.Printf("Error listing files for PR #%d: %v", pr.Number, err)
+		check.Fail(ctx, err)
 		return
 	}
 
-	updated := false
-	// var changelogContent string
-	var changes strings.Builder
-
-	// Check if the CHANGELOG.md file is updated and collect the changes
+	// Check if the changelog is updated
+	var changelog *github.CommitFile
 	for _, file := range files {
 		log.Printf("Processing PR file " + file.GetFilename())
-		if file.GetFilename() == "CHANGELOG.md" {
-			updated = true
-			// changelogContent = file.GetPatch()
+		if file.GetFilename() == path {
+			changelog = file
+		}
+	}
+
+	// Read the changelog at the head of the pull request, for the headings around the entry and the section to suggest
+	content, _, err := utils.GetFileContent(ctx, client, owner, repo, path, pr.Head.SHA)
+	if err != nil {
+		log.Printf("Error fetching %s of PR #%d: %v", path, pr.Number, err)
+		check.Fail(ctx, err)
+		return
+	}
+
+	// Validate the entry, a well-formed one needs no suggestions
+	var problems []ChangelogProblem
+	var annotations []*github.CheckRunAnnotation
+	if changelog != nil {
+		validation := ChangelogValidation{Problems: []ChangelogProblem{{Message: "The pull request deletes the changelog."}}}
+		if changelog.GetStatus() != "removed" {
+			validation, err = ValidateChangelog(content, changelog.GetPatch())
+			if err != nil {
+				log.Printf("Error validating %s of PR #%d: %v", path, pr.Number, err)
+				check.Fail(ctx, err)
+				return
+			}
+		}
+		if validation.Valid() {
+			check.Complete(ctx, ConclusionSuccess, path+" is updated", fmt.Sprintf("Jambo! Thanks for adding %d entries to `%s`.", validation.Entries, path), nil)
+			return
+		}
+		problems = validation.Problems
+		for _, problem := range problems {
+			if problem.Line > 0 {
+				annotations = append(annotations, &github.CheckRunAnnotation{
+					Path:            github.String(path),
+					StartLine:       github.Int(problem.Line),
+					EndLine:         github.Int(problem.Line),
+					AnnotationLevel: github.String("warning"),
+					Message:         github.String(problem.Message),
+				})
+			}
 		}
+	}
+
+	// Collect the changes worth sending to the LLM
+	var changes strings.Builder
+	sent, skipped := LoadDiffFilter(ctx, client, config, owner, repo, pr.Base.Ref).Filter(files)
+	check.Note(FormatSkippedFiles(skipped))
+	for _, file := range sent {
 		changes.WriteString(fmt.Sprintf("File: %s\n", file.GetFilename()))
 		changes.WriteString(fmt.Sprintf("Changes: %s\n\n", file.GetPatch()))
 	}
 
-	// Prepare the prompt for suggestions
-	var prompt string
-	if !updated {
-		prompt = fmt.Sprintf("Remind the user to update their CHANGELOG.md file. Please provide suggestions for the changelog based on the following changes:\n\n%s", changes.String())
+	// Prepare the prompt for the [Unreleased] section
+	var prompt, title, summary string
+	current := UnreleasedEntries(content)
+	if current == "" {
+		current = "(empty)"
+	}
+	if changelog == nil {
+		title = path + " is not updated"
+		summary = fmt.Sprintf("Jambo! This pull request does not update `%s`.", path)
+		prompt = fmt.Sprintf("The user did not update their %s file. The [Unreleased] section currently reads:\n\n%s\n\nWrite the section with an entry for the following changes:\n\n%s", path, current, changes.String())
 	} else {
-		prompt = fmt.Sprintf("Remind the user to update their CHANGELOG.md file. Please provide suggestions for the changelog based on the following changes:\n\n%s", changes.String())
+		title = path + " entry does not follow Keep a Changelog"
+		summary = fmt.Sprintf("Jambo! The update to `%s` does not follow Keep a Changelog:\n%s", path, FormatChangelogProblems(path, problems))
+		prompt = fmt.Sprintf("The user updated their %s file, but the entry does not follow Keep a Changelog:\n%s\nThe [Unreleased] section currently reads:\n\n%s\n\nWrite the section with the problems fixed and an entry for the following changes:\n\n%s", path, FormatChangelogProblems(path, problems), current, changes.String())
 	}
 
-	// Send the prompt to the LLM for suggestions
+	// Send the prompt to the LLM for the section
 	message := map[string]string{
 		"PullReqBody": prompt,
 	}
-	resp, err := AddRow(jamaiClient, models.ActionTable, fmt.Sprintf("%s_%s_%s", owner, repo, utils.GetBotVersion()), message)
+	outputs, err := llm.Generate(ctx, message, "PullReqResponse")
 	if err != nil {
-		log.Fatalf("Error getting changelog suggestions from LLM: %v", err)
+		log.Printf("Error getting changelog suggestions from LLM: %v", err)
+		// The problems with the entry are known without the LLM
+		check.Note(skippedNotice(ctx, check, "changelog suggestions", err))
+		check.Complete(ctx, ConclusionFailure, title, summary, annotations)
+		return
 	}
 
-	// Read and collect the suggestions from the response
-	suggestions, err := readAndCollectContent(resp, "PullReqResponse")
+	// Only a well-formed section is offered for committing, anything else is reported as it is
+	response := outputs["PullReqResponse"].Content
+	section := NormalizeChangelogSection(response)
+	if !validateChangelogSection(section).Valid() {
+		log.Printf("The changelog section suggested for PR #%d does not follow Keep a Changelog", pr.Number)
+		check.Complete(ctx, ConclusionFailure, title, summary+"\n\n"+response, annotations)
+		return
+	}
+	summary += fmt.Sprintf("\n\nSuggested `[Unreleased]` section:\n\n%s", FormatChangelogSuggestion(section))
+
+	// Suggest the section on the changelog if it is part of the diff, and offer the command otherwise
+	suggested := false
+	if changelog != nil {
+		suggested, err = SuggestChangelogSection(ctx, client, owner, repo, pr, changelog, content, section)
+		if err != nil {
+			log.Printf("Error suggesting the changelog section on PR #%d: %v", pr.Number, err)
+		}
+	}
+	if suggested {
+		summary += fmt.Sprintf("\n\nI suggested this section on `%s` in a review comment, which you can commit from the **Files changed** tab.", path)
+	} else {
+		summary += fmt.Sprintf("\n\nComment `%s` on this pull request to commit this section to its branch.", ApplyChangelogCommand)
+	}
+	check.Complete(ctx, ConclusionFailure, title, summary, annotations)
+}
+
+const (
+	// maxListedFiles is the number of files GitHub lists for a pull request or commit.
+	maxListedFiles = 3000
+	// maxListedCommits is the number of commits GitHub lists for a pull request.
+	maxListedCommits = 250
+	// maxDiffBytes is the size of the largest raw diff that is read.
+	maxDiffBytes = 100 << 20
+)
+
+// ListPullRequestFiles returns every file changed in a pull request, including their patches. GitHub lists at most
+// 3000 files, so the files of larger pull requests are read from the raw diff at the pull request's DiffURL instead.
+func ListPullRequestFiles(ctx context.Context, client *github.Client, owner, repo string, pr *models.PullRequest) ([]*github.CommitFile, error) {
+	files, err := utils.ListAll(func(opts *github.ListOptions) ([]*github.CommitFile, *github.Response, error) {
+		return client.PullRequests.ListFiles(ctx, owner, repo, pr.Number, opts)
+	})
 	if err != nil {
-		log.Fatalf("Error processing PR %d:\n%v", pr.Number, err)
+		return nil, fmt.Errorf("error listing files of PR #%d: %w", pr.Number, err)
+	}
+	if len(files) < maxListedFiles {
+		return files, nil
 	}
 
-	// Comment on the pull request with the suggestions
-	utils.CommentOnIssue(ctx, client, owner, repo, pr.Number, suggestions)
+	log.Printf("PR #%d changes more than the %d files GitHub lists, reading its raw diff", pr.Number, maxListedFiles)
+	diff, err := getPullRequestDiff(ctx, client, owner, repo, pr)
+	if err != nil {
+		// The listed files are still better than none
+		log.Printf("Error reading the diff of PR #%d, using the first %d files: %v", pr.Number, len(files), err)
+		RecordError(ctx, err)
+		return files, nil
+	}
+	return utils.ParseDiffFiles(diff), nil
 }
 
-// getCommitDiff fetches the diff of a specific commit.
-func getCommitDiff(ctx context.Context, client *github.Client, owner, repo, sha string) (string, error) {
-	commit, _, err := client.Repositories.GetCommit(ctx, owner, repo, sha, nil)
+// getPullRequestDiff downloads the raw diff of a pull request from its DiffURL, looking the URL up if the
+// pull request does not carry it.
+func getPullRequestDiff(ctx context.Context, client *github.Client, owner, repo string, pr *models.PullRequest) (string, error) {
+	diffURL := pr.DiffURL
+	if diffURL == "" {
+		ghPR, _, err := client.PullRequests.Get(ctx, owner, repo, pr.Number)
+		if err != nil {
+			return "", fmt.Errorf("error fetching PR #%d: %w", pr.Number, err)
+		}
+		diffURL = ghPR.GetDiffURL()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, diffURL, nil)
 	if err != nil {
-		return "", fmt.Errorf("error fetching commit %s: %w", sha, err)
+		return "", fmt.Errorf("error creating diff request: %w", err)
 	}
+	resp, err := client.Client().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error fetching %s: %w", diffURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code fetching %s: %d", diffURL, resp.StatusCode)
+	}
+	diff, err := io.ReadAll(io.LimitReader(resp.Body, maxDiffBytes))
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %w", diffURL, err)
+	}
+	return string(diff), nil
+}
+
+// listPullRequestCommits returns the commits of a pull request, of which GitHub lists at most 250.
+func listPullRequestCommits(ctx context.Context, client *github.Client, owner, repo string, prNumber int) ([]*github.RepositoryCommit, error) {
+	commits, err := utils.ListAll(func(opts *github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
+		return client.PullRequests.ListCommits(ctx, owner, repo, prNumber, opts)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing commits for PR #%d: %w", prNumber, err)
+	}
+	if len(commits) >= maxListedCommits {
+		log.Printf("PR #%d has more than the %d commits GitHub lists, later commits are not checked", prNumber, maxListedCommits)
+	}
+	return commits, nil
+}
 
-	var diff strings.Builder
-	for _, file := range commit.Files {
-		log.Printf("Getting diff for %s", *file.Filename)
-		if file.GetPatch() != "" {
-			diff.WriteString(fmt.Sprintf("File: %s\n%s\n", file.GetFilename(), file.GetPatch()))
+// getCommitFiles fetches the files changed by a specific commit, including their patches.
+func getCommitFiles(ctx context.Context, client *github.Client, owner, repo, sha string) ([]*github.CommitFile, error) {
+	files, err := utils.ListAll(func(opts *github.ListOptions) ([]*github.CommitFile, *github.Response, error) {
+		commit, resp, err := client.Repositories.GetCommit(ctx, owner, repo, sha, opts)
+		if err != nil {
+			return nil, resp, err
 		}
+		return commit.Files, resp, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching commit %s: %w", sha, err)
 	}
 
-	return diff.String(), nil
+	for _, file := range files {
+		log.Printf("Getting diff for %s", file.GetFilename())
+	}
+	if len(files) >= maxListedFiles {
+		log.Printf("Commit %s changes more than the %d files GitHub lists, later files are not checked", sha, maxListedFiles)
+	}
+	return files, nil
 }
 
-// CheckSecretKeyLeakage checks for potential secret key leakage using LLM across all commits in a pull request.
-func CheckSecretKeyLeakage(ctx context.Context, client *github.Client, jamaiClient *http.Client, owner, repo string, pr *models.PullRequest) {
+// CheckSecretKeyLeakage checks for potential secret key leakage across all commits in a pull request.
+// The lines added by every commit are scanned with the built-in secret rules, whose matches are reported even
+// if the LLM is unavailable. Ambiguous candidates are adjudicated by the LLM, one diff chunk at a time, and
+// the findings of all chunks are merged into a single verdict per commit. Findings accepted by the secrets
+// baseline of the base branch are dropped before anything is adjudicated or reported.
+//
+// If before names the previous head of the pull request, the commits its secrets check run scanned completely
+// are only scanned again by the rules, their candidates were already rejected by the LLM. A force-push that
+// rewrote the history before it is detected by before no longer being a commit of the pull request, and every
+// commit is scanned again.
+//
+// The outcome is reported in the JambuBot secrets check run. The details of the findings only go to the
+// configured secret notifiers, the check_run notifier adds them to that check run. Otherwise the check run,
+// like the public pull request conversation, gets a neutral notice that does not advertise a leaked credential.
+func CheckSecretKeyLeakage(ctx context.Context, client *github.Client, llm LLMProvider, config *models.BotConfig, owner, repo string, pr *models.PullRequest, before string) {
+	check := StartCheckReport(ctx, client, owner, repo, pr, SecretsCheckName)
+
 	// List the commits in the pull request
-	commits, _, err := client.PullRequests.ListCommits(ctx, owner, repo, pr.Number, nil)
+	commits, err := listPullRequestCommits(ctx, client, owner, repo, pr.Number)
 	if err != nil {
 		log.Printf("Error listing commits for PR #%d: %v", pr.Number, err)
+		check.Fail(ctx, err)
 		return
 	}
 
+	// Findings accepted in the secrets baseline of the base branch are never reported. The pull request's own
+	// baseline is not trusted, as anyone opening a pull request could accept their own secrets with it.
+	baseline := LoadSecretsBaseline(ctx, client, owner, repo, pr.Base.Ref)
+	// Noise such as lockfiles is scanned by the rules, but never sent to the LLM. The .gitattributes of the base
+	// branch is used for the same reason as its baseline, a pull request could mark its own files as generated.
+	filter := LoadDiffFilter(ctx, client, config, owner, repo, pr.Base.Ref)
+	var skipped []SkippedFile
+
+	// Reuse the scan of the commits before the push, unless the push rewrote them
+	scanned := map[string]bool{}
+	if before != "" {
+		if state := LoadSecretScanState(ctx, client, owner, repo, before); state != nil {
+			if containsCommit(commits, before) {
+				for _, sha := range state.Commits {
+					scanned[sha] = true
+				}
+			} else {
+				log.Printf("Commit %s is no longer part of PR #%d, scanning every commit after a force-push", before, pr.Number)
+			}
+		}
+	}
+
+	chunkTokens := ChunkTokens()
+	var verdicts []*secretVerdict
+	var llmErr error
 	// Check each commit for potential secret key leakage
 	for _, commit := range commits {
 		// Skip the current commit if its a merge commit (commits with more than one parent are merge commits.
@@ -99,78 +304,344 @@ func CheckSecretKeyLeakage(ctx context.Context, client *github.Client, jamaiClie
 		if len(commit.Parents) > 1 {
 			continue
 		}
-		var changes strings.Builder
+
 		log.Print("Processing Commit SHA " + commit.GetSHA())
-		diff, err := getCommitDiff(ctx, client, owner, repo, commit.GetSHA())
+		files, err := getCommitFiles(ctx, client, owner, repo, commit.GetSHA())
 		if err != nil {
 			log.Printf("Error fetching diff for commit %s: %v", commit.GetSHA(), err)
+			RecordError(ctx, err)
+			continue
+		}
 
+		// Commits scanned before the push only keep their rule matches, the LLM rejected all their candidates
+		if scanned[commit.GetSHA()] {
+			verdict := &secretVerdict{commit: commit.GetSHA(), reused: true}
+			for _, finding := range FilterBaseline(baseline, DetectSecrets(ctx, commit.GetSHA(), files)) {
+				if finding.Confirmed {
+					verdict.findings = append(verdict.findings, finding)
+				}
+			}
+			verdicts = append(verdicts, verdict)
+			continue
 		}
-		changes.WriteString(fmt.Sprintf("Commit: %s\n", commit.GetSHA()))
-		changes.WriteString(fmt.Sprintf("Diff:\n %s", diff))
-		log.Printf("Diff of commit %s:\n %s", commit.GetSHA(), diff)
-		prompt := changes.String()
 
-		message := map[string]string{
-			"PullReqSecretsBody": prompt,
+		// Rule matches are findings right away, everything else needs the LLM's judgement
+		verdict := &secretVerdict{commit: commit.GetSHA()}
+		verdicts = append(verdicts, verdict)
+		var candidates []models.SecretFinding
+		for _, finding := range FilterBaseline(baseline, DetectSecrets(ctx, commit.GetSHA(), files)) {
+			if finding.Confirmed {
+				verdict.findings = append(verdict.findings, finding)
+			} else {
+				candidates = append(candidates, finding)
+			}
 		}
 
-		resp, err := AddRow(jamaiClient, models.ActionTable, fmt.Sprintf("%s_%s_%s", owner, repo, utils.GetBotVersion()), message)
-		if err != nil {
-			log.Fatalf("Error getting secret key leakage suggestions from LLM: %v", err)
+		// Adjudicate the candidates of every chunk of the diff independently,
+		// unless the LLM already failed on an earlier commit
+		if len(candidates) == 0 {
+			continue
 		}
-		result, err := readAndCollectContent(resp, "SecretsJSONResponse")
-		if err != nil {
-			log.Fatalf("Error processing PR %d:\n%v", pr.Number, err)
+		if llmErr != nil {
+			verdict.skipped = true
+			continue
 		}
-		suggestions, err := parseCreatePrSecretResponse(result)
-		if err != nil {
-			log.Printf("Error unmarshaling secret response:\n%v", err)
-			if strings.Contains(result, "ContextWindowExceededError") {
-				utils.CommentOnIssue(ctx, client, owner, repo, pr.Number, fmt.Sprintf("Jambo! It seems that commit %s was too long to scan for secret leaks. Please shorten your commits next time!", commit.GetSHA()))
-			} else {
-				utils.CommentOnIssue(ctx, client, owner, repo, pr.Number, fmt.Sprintf("Jambo! I had issues checking commit %s for secret leaks. Please contact my developers for more assistance! Error Message:\n %v\nResponse: %s", commit.GetSHA(), err, result))
+		sent, commitSkipped := filter.Filter(files)
+		skipped = append(skipped, commitSkipped...)
+		chunks := ChunkDiff(sent, chunkTokens)
+		for i, chunk := range chunks {
+			chunkCandidates := candidatesInChunk(chunk, candidates)
+			if len(chunkCandidates) == 0 {
+				continue
+			}
+			log.Printf("Adjudicating %d candidates in part %d of %d of commit %s", len(chunkCandidates), i+1, len(chunks), commit.GetSHA())
+			if llmErr = adjudicateSecretChunk(ctx, llm, commit.GetSHA(), chunk, chunkCandidates, chunkTokens, verdict); llmErr != nil {
+				log.Printf("Error getting secret key leakage suggestions from LLM: %v", llmErr)
+				verdict.skipped = true
+				break
+			}
+		}
+
+		// Candidates in files the filter skipped or truncated were never adjudicated
+		if llmErr == nil {
+			for _, candidate := range candidatesOutsideChunks(chunks, candidates) {
+				verdict.unchecked = append(verdict.unchecked, candidate.File)
 			}
+		}
+	}
+	check.SetText(secretScanText(verdicts))
+	check.Note(FormatSkippedFiles(skipped))
+
+	// Send the details privately and leave a neutral notice in the check run
+	report := &models.SecretReport{Owner: owner, Repo: repo, PullRequest: pr.Number, HeadSHA: pr.Head.SHA}
+	var leakedCommits []string
+	incomplete := false
+	for _, verdict := range verdicts {
+		if len(verdict.findings) > 0 {
+			report.Findings = append(report.Findings, verdict.findings...)
+			leakedCommits = append(leakedCommits, verdict.commit)
+		}
+		if notice := verdict.notice(); notice != "" {
+			incomplete = true
+			check.Note(notice)
+		}
+	}
+	RecordFindings(ctx, SecretFindingResults(report.Findings)...)
+	if llmErr != nil {
+		check.Note(skippedNotice(ctx, check, "secret leak", llmErr))
+	}
+
+	switch {
+	case len(report.Findings) > 0:
+		// The check_run notifier completes the check run with the details
+		delivered := NotifySecretFindings(ctx, NewSecretNotifiers(config, client, check), report)
+		notice := fmt.Sprintf("Jambo! Some changes in this pull request need a security review before merging: %s.", strings.Join(leakedCommits, ", "))
+		if delivered > 0 {
+			notice += " I have shared the details with the maintainers privately."
+		} else {
+			notice += " Please ask the maintainers to review them."
+		}
+		check.Complete(ctx, secretsConclusion(config.Secrets.FailOn, report.Findings), "Security review needed", notice, nil)
+	case llmErr != nil:
+		check.Complete(ctx, ConclusionNeutral, "Skipped", "", nil)
+	case incomplete:
+		check.Complete(ctx, ConclusionNeutral, "Some changes could not be checked", "", nil)
+	default:
+		check.Complete(ctx, ConclusionSuccess, "No secrets found", fmt.Sprintf("Jambo! I found no secrets in the %d commits of this pull request.", len(verdicts)), nil)
+	}
+}
+
+// secretScanText records the commits that were scanned completely in the text of the check run, so that the next push
+// does not send their candidates to the LLM again. Commits with candidates the LLM confirmed are left out, as the
+// text of the check run is public and the next push can only restore rule matches.
+func secretScanText(verdicts []*secretVerdict) string {
+	state := &models.SecretScanState{}
+	reused := 0
+	for _, verdict := range verdicts {
+		if verdict.skipped || verdict.adjudicated || len(verdict.tooLong) > 0 || len(verdict.failed) > 0 || len(verdict.unchecked) > 0 {
 			continue
 		}
+		if verdict.reused {
+			reused++
+		}
+		state.Commits = append(state.Commits, verdict.commit)
+	}
+	marker, err := FormatSecretScanState(state)
+	if err != nil {
+		log.Printf("Error recording the scanned commits: %v", err)
+		return ""
+	}
+	return fmt.Sprintf("Scanned %d new commits, reused the scan of %d earlier commits.\n\n%s", len(state.Commits)-reused, reused, marker)
+}
 
-		if suggestions.Leak {
-			var response string
-			if suggestions.Commit == "" {
-				response = fmt.Sprintf("Commit %s:\n%s", commit.GetSHA(), suggestions.Response)
-			} else {
-				response = fmt.Sprintf("Commit %s:\n%s", suggestions.Commit, suggestions.Response)
+// containsCommit reports whether a commit is one of the commits.
+func containsCommit(commits []*github.RepositoryCommit, sha string) bool {
+	for _, commit := range commits {
+		if commit.GetSHA() == sha {
+			return true
+		}
+	}
+	return false
+}
+
+// secretsConclusion fails the secrets check run if a finding is at or above the repository's severity threshold.
+// Findings below it leave the check run neutral.
+func secretsConclusion(failOn string, findings []models.SecretFinding) string {
+	for _, finding := range findings {
+		if AtOrAbove(finding.Severity, failOn) {
+			return ConclusionFailure
+		}
+	}
+	return ConclusionNeutral
+}
+
+// secretVerdict merges the findings of the chunks of one commit.
+type secretVerdict struct {
+	commit      string                 // The commit hash.
+	findings    []models.SecretFinding // Rule matches and candidates confirmed by the LLM.
+	reused      bool                   // Whether the commit was scanned before the push, so only the rules were applied.
+	adjudicated bool                   // Whether the LLM confirmed any of the candidates.
+	skipped     bool                   // Whether candidates were left unadjudicated because the LLM was unavailable.
+	tooLong     []string               // Files of chunks that were too long to scan even at the smallest chunk size.
+	failed      []string               // Files of chunks whose response could not be parsed.
+	unchecked   []string               // Files with candidates that the diff filter kept from the LLM.
+	lastError   error                  // The last parse error, reported to the developers.
+	lastResult  string                 // The response that caused lastError, with the event's secrets masked.
+}
+
+// candidatesInChunk returns the candidates whose value appears in a chunk's patch of their file.
+func candidatesInChunk(chunk DiffChunk, candidates []models.SecretFinding) []models.SecretFinding {
+	var inChunk []models.SecretFinding
+	for _, candidate := range candidates {
+		for _, piece := range chunk.Pieces {
+			if piece.File == candidate.File && strings.Contains(piece.Patch, candidate.Match) {
+				inChunk = append(inChunk, candidate)
+				break
 			}
-			utils.CommentOnIssue(ctx, client, owner, repo, pr.Number, response)
 		}
 	}
+	return inChunk
 }
 
-// parseCreatePrSecretResponse parses the response into CreatePullReqSecretResponse.
-func parseCreatePrSecretResponse(content string) (models.CreatePullReqSecretResponse, error) {
-	var prSecretResponse models.CreatePullReqSecretResponse
-	if err := json.Unmarshal([]byte(content), &prSecretResponse); err != nil {
-		return prSecretResponse, err
+// candidatesOutsideChunks returns the candidates whose value appears in none of the chunks of a commit's diff,
+// because the diff filter skipped their file or truncated its patch before the value.
+func candidatesOutsideChunks(chunks []DiffChunk, candidates []models.SecretFinding) []models.SecretFinding {
+	var outside []models.SecretFinding
+	for _, candidate := range candidates {
+		found := false
+		for _, chunk := range chunks {
+			if len(candidatesInChunk(chunk, []models.SecretFinding{candidate})) > 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			outside = append(outside, candidate)
+		}
 	}
-	return prSecretResponse, nil
+	return outside
 }
 
-// Deletes any existing comments of a bot name
-func DeleteBotComments(ctx context.Context, client *github.Client, jamaiClient *http.Client, owner, repo string, pr *models.PullRequest, botName string) {
-	comments, _, err := client.Issues.ListComments(ctx, owner, repo, pr.Number, nil)
+// adjudicateSecretChunk asks the LLM whether the candidates in one chunk of a commit's diff are leaked secrets
+// and adds the confirmed candidates to the verdict. A chunk the model rejects as too long is split in half and
+// adjudicated again, down to minChunkTokens. Only errors from the LLM provider itself are returned.
+func adjudicateSecretChunk(ctx context.Context, llm LLMProvider, sha string, chunk DiffChunk, candidates []models.SecretFinding, maxTokens int, verdict *secretVerdict) error {
+	var prompt strings.Builder
+	prompt.WriteString("The following values on added lines were flagged as possible secrets by an automated scanner:\n")
+	for _, candidate := range candidates {
+		prompt.WriteString(fmt.Sprintf("- %s line %d (%s): %s\n", candidate.File, candidate.Line, candidate.Description, candidate.Match))
+	}
+	prompt.WriteString("Decide for each of them, by its file and line, whether it is a real secret rather than a placeholder, hash, identifier or test value.\n\n")
+	diff := chunk.String()
+	log.Printf("Sending %d bytes of the diff of commit %s to the LLM: %s", len(diff), sha, strings.Join(chunk.Files(), ", "))
+	prompt.WriteString(fmt.Sprintf("Commit: %s\nDiff:\n %s", sha, diff))
+	message := map[string]string{
+		"PullReqSecretsBody": prompt.String(),
+	}
+
+	// Read the plain text verdict and its JSON form from the same row
+	outputs, err := llm.Generate(ctx, message, "PullReqSecretsResponse", "SecretsJSONResponse")
 	if err != nil {
-		log.Printf("Error fetching comments on PR #%d:\n%v", pr.Number, err)
+		return err
 	}
-	for _, comment := range comments {
-		log.Printf("Listing comments... comment user:%s", *comment.User.Login)
-		if strings.Contains(*comment.User.Login, botName) {
-			log.Printf("Deleting %s's comment with ID %d", botName, *comment.ID)
-			_, err := utils.DeleteComment(ctx, client, owner, repo, *comment.ID)
-			if err != nil {
-				log.Printf("Error deleting %s's comment with comment ID %d:\n%v", botName, *comment.ID, err)
+	result := outputs["SecretsJSONResponse"].Content
+	suggestions, err := parseCreatePrSecretResponse(result)
+	if err != nil {
+		// The response often quotes the candidates, the log writer only masks well-known formats
+		log.Printf("Error unmarshaling secret response:\n%v\nPlain text response: %s", err, utils.Redact(ctx, outputs["PullReqSecretsResponse"].Content))
+		if strings.Contains(result, "ContextWindowExceededError") || strings.Contains(outputs["PullReqSecretsResponse"].Content, "ContextWindowExceededError") {
+			if maxTokens/2 < minChunkTokens {
+				verdict.tooLong = append(verdict.tooLong, chunk.Files()...)
+				return nil
+			}
+			for _, smaller := range RechunkDiff(chunk, maxTokens/2) {
+				smallerCandidates := candidatesInChunk(smaller, candidates)
+				if len(smallerCandidates) == 0 {
+					continue
+				}
+				if err := adjudicateSecretChunk(ctx, llm, sha, smaller, smallerCandidates, maxTokens/2, verdict); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		verdict.failed = append(verdict.failed, chunk.Files()...)
+		verdict.lastError = err
+		verdict.lastResult = utils.Redact(ctx, result)
+		return nil
+	}
+
+	confirmed := confirmCandidates(candidates, suggestions.Candidates)
+	verdict.adjudicated = verdict.adjudicated || len(confirmed) > 0
+	verdict.findings = append(verdict.findings, confirmed...)
+	return nil
+}
+
+// confirmCandidates returns the candidates the LLM marked as leaks, explained by its reason for each of them.
+// Candidates are matched to the verdicts by file and line, so a real secret does not confirm its neighbours.
+func confirmCandidates(candidates []models.SecretFinding, verdicts []models.SecretCandidateVerdict) []models.SecretFinding {
+	var confirmed []models.SecretFinding
+	for _, candidate := range candidates {
+		for _, verdict := range verdicts {
+			if verdict.Leak && verdict.File == candidate.File && verdict.Line == candidate.Line {
+				candidate.Confirmed = true
+				candidate.Explanation = verdict.Reason
+				confirmed = append(confirmed, candidate)
+				break
 			}
 		}
 	}
+	return confirmed
+}
+
+// notice renders the problems scanning the commit as a pull request comment, or returns an empty string if
+// there were none. Findings are never part of the notice, they are sent to the secret notifiers.
+func (v *secretVerdict) notice() string {
+	var notice strings.Builder
+	if len(v.tooLong) > 0 {
+		notice.WriteString(fmt.Sprintf("Jambo! Some changes in commit %s were too long to check for secret leaks, even in small parts: %s. Please shorten your commits next time!", v.commit, strings.Join(uniqueStrings(v.tooLong), ", ")))
+	}
+	if len(v.failed) > 0 {
+		if notice.Len() > 0 {
+			notice.WriteString("\n\n")
+		}
+		// The response may quote a secret, so it only goes to the log
+		log.Printf("Unparseable secret response for commit %s: %s", v.commit, v.lastResult)
+		notice.WriteString(fmt.Sprintf("Jambo! I had issues checking the changes to %s in commit %s for secret leaks. Please contact my developers for more assistance! Error Message:\n %v", strings.Join(uniqueStrings(v.failed), ", "), v.commit, v.lastError))
+	}
+	if len(v.unchecked) > 0 {
+		if notice.Len() > 0 {
+			notice.WriteString("\n\n")
+		}
+		notice.WriteString(fmt.Sprintf("Jambo! Some values in commit %s look like secrets, but are in files I do not send to the LLM, such as lockfiles and generated files: %s. Please check them yourself before merging!", v.commit, strings.Join(uniqueStrings(v.unchecked), ", ")))
+	}
+	return notice.String()
+}
+
+// uniqueStrings returns the distinct values in order of first appearance.
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// skippedNotice records that a check did not run because the LLM is unavailable or the repository has used up
+// its daily token budget, and returns the notice for the pull request author. When the check is reported in
+// comments, the budget notice is given at most once per pull request a day and is empty after that.
+func skippedNotice(ctx context.Context, report *CheckReport, check string, err error) string {
+	RecordError(ctx, fmt.Errorf("%s check skipped: %w", check, err))
+	if errors.Is(err, ErrBudgetExceeded) {
+		if !report.HasCheckRun() {
+			first, storeErr := DefaultUsageStore().MarkBudgetNotice(report.owner+"/"+report.repo, report.prNumber)
+			if storeErr != nil {
+				log.Printf("Error recording budget notice for PR #%d: %v", report.prNumber, storeErr)
+			}
+			if !first {
+				return ""
+			}
+		}
+		return fmt.Sprintf("Jambo! I skipped the %s check on this pull request because this repository has used up its daily language model budget. It will run again on your next push after the budget resets at midnight UTC.", check)
+	}
+	return fmt.Sprintf("Jambo! I skipped the %s check on this pull request because my language model service is unavailable right now. It will run again on your next push.", check)
+}
+
+// parseCreatePrSecretResponse parses the response into CreatePullReqSecretResponse.
+func parseCreatePrSecretResponse(content string) (models.CreatePullReqSecretResponse, error) {
+	var prSecretResponse models.CreatePullReqSecretResponse
+	if err := json.Unmarshal([]byte(content), &prSecretResponse); err != nil {
+		return prSecretResponse, err
+	}
+	// A leak must be pinned to its candidates, the whole chunk is never confirmed at once
+	if prSecretResponse.Leak && len(prSecretResponse.Candidates) == 0 {
+		return prSecretResponse, fmt.Errorf("the response reports a leak without a verdict on each candidate")
+	}
+	return prSecretResponse, nil
 }
 
 // SuggestLabelsForPR suggests labels for a pull request.
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/wenjielee1/github-bot/models"
+	"github.com/wenjielee1/github-bot/utils"
+)
+
+func TestCandidatesOutsideChunks(t *testing.T) {
+	files := []*github.CommitFile{
+		{Filename: github.String("main.go"), Patch: github.String("@@ -0,0 +1 @@\n+token := \"kept-value\"")},
+		{Filename: github.String("api/client.go"), Patch: github.String("@@ -0,0 +1 @@\n+token := \"generated-value\"")},
+		{Filename: github.String("big.go"), Patch: github.String("@@ -0,0 +2 @@\n+// " + strings.Repeat("x", 100) + "\n+token := \"truncated-value\"")},
+	}
+	candidates := []models.SecretFinding{
+		{File: "main.go", Line: 1, Match: "kept-value"},
+		{File: "api/client.go", Line: 1, Match: "generated-value"},
+		{File: "big.go", Line: 2, Match: "truncated-value"},
+	}
+	filter := NewDiffFilter(models.DiffConfig{MaxFileBytes: 80}, "api/** linguist-generated\n")
+	sent, _ := filter.Filter(files)
+
+	outside := candidatesOutsideChunks(ChunkDiff(sent, 1000), candidates)
+	if len(outside) != 2 || outside[0].File != "api/client.go" || outside[1].File != "big.go" {
+		t.Fatalf("got %+v, want the candidates of the skipped and the truncated file", outside)
+	}
+
+	verdict := &secretVerdict{commit: "abc", unchecked: []string{"api/client.go", "big.go", "big.go"}}
+	notice := verdict.notice()
+	if !strings.Contains(notice, "api/client.go, big.go.") {
+		t.Errorf("got notice %q, want each file listed once", notice)
+	}
+	if text := secretScanText([]*secretVerdict{verdict}); strings.Contains(text, "abc") {
+		t.Errorf("got scan state %q, want the commit left out", text)
+	}
+}
+
+// fakeLLM answers every row with the same secrets JSON response.
+type fakeLLM struct {
+	secretsJSON string
+}
+
+func (f *fakeLLM) Setup(ctx context.Context, agents []models.Agent) error {
+	return nil
+}
+
+func (f *fakeLLM) Generate(ctx context.Context, inputs map[string]string, outputColumns ...string) (map[string]models.ColumnResult, error) {
+	return map[string]models.ColumnResult{
+		"PullReqSecretsResponse": {Content: "plain text"},
+		"SecretsJSONResponse":    {Content: f.secretsJSON},
+	}, nil
+}
+
+func TestAdjudicateSecretChunkConfirmsEachCandidate(t *testing.T) {
+	patch := "@@ -0,0 +1,3 @@\n+key = \"Zx9qL2mP8vR4tY7wK1nB5cD3fG6hJ0sA\"\n+sum = \"da0ab0ba3330ac795276ebbbe4f4d3efda346c05\"\n+password = \"${DB_PASSWORD}\""
+	chunk := DiffChunk{Pieces: []DiffPiece{{File: "client.py", Patch: patch}}}
+	candidates := []models.SecretFinding{
+		{File: "client.py", Line: 1, Match: "Zx9qL2mP8vR4tY7wK1nB5cD3fG6hJ0sA"},
+		{File: "client.py", Line: 2, Match: "da0ab0ba3330ac795276ebbbe4f4d3efda346c05"},
+		{File: "client.py", Line: 3, Match: "${DB_PASSWORD}"},
+	}
+	tests := []struct {
+		name      string
+		response  string
+		confirmed []int
+		failed    bool
+	}{
+		{
+			name:      "one leak among placeholders",
+			response:  `{"leak": true, "response": "A key leaked.", "candidates": [{"file": "client.py", "line": 1, "leak": true, "reason": "Looks like a real key."}, {"file": "client.py", "line": 2, "leak": false, "reason": "A commit SHA."}, {"file": "client.py", "line": 3, "leak": false, "reason": "A placeholder."}]}`,
+			confirmed: []int{1},
+		},
+		{
+			name:     "no leak",
+			response: `{"leak": false, "response": "No leaks.", "candidates": []}`,
+		},
+		{
+			name:     "verdict on another line",
+			response: `{"leak": true, "response": "A key leaked.", "candidates": [{"file": "client.py", "line": 9, "leak": true, "reason": "Looks like a real key."}]}`,
+		},
+		{
+			name:     "leak without candidates",
+			response: `{"leak": true, "response": "A key leaked."}`,
+			failed:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verdict := &secretVerdict{commit: "abc"}
+			if err := adjudicateSecretChunk(context.Background(), &fakeLLM{secretsJSON: test.response}, "abc", chunk, candidates, 4000, verdict); err != nil {
+				t.Fatalf("adjudicateSecretChunk: %v", err)
+			}
+			if len(verdict.findings) != len(test.confirmed) {
+				t.Fatalf("got %d findings %+v, want lines %v", len(verdict.findings), verdict.findings, test.confirmed)
+			}
+			for i, finding := range verdict.findings {
+				if finding.Line != test.confirmed[i] || !finding.Confirmed || finding.Explanation != "Looks like a real key." {
+					t.Errorf("got %+v, want line %d confirmed with its own reason", finding, test.confirmed[i])
+				}
+			}
+			if failed := len(verdict.failed) > 0; failed != test.failed {
+				t.Errorf("got failed %v, want %v", verdict.failed, test.failed)
+			}
+		})
+	}
+}
+
+func TestAdjudicateSecretChunkMasksUnparseableResponse(t *testing.T) {
+	ctx := utils.WithRedactor(context.Background())
+	utils.RegisterSecret(ctx, "Zx9qL2mP8vR4tY7wK1nB5cD3fG6hJ0sA")
+	chunk := DiffChunk{Pieces: []DiffPiece{{File: "client.py", Patch: "@@ -0,0 +1 @@\n+key = \"Zx9qL2mP8vR4tY7wK1nB5cD3fG6hJ0sA\""}}}
+	candidates := []models.SecretFinding{{File: "client.py", Line: 1, Match: "Zx9qL2mP8vR4tY7wK1nB5cD3fG6hJ0sA"}}
+	llm := &fakeLLM{secretsJSON: "The key Zx9qL2mP8vR4tY7wK1nB5cD3fG6hJ0sA is real."}
+
+	verdict := &secretVerdict{commit: "abc"}
+	if err := adjudicateSecretChunk(ctx, llm, "abc", chunk, candidates, 4000, verdict); err != nil {
+		t.Fatalf("adjudicateSecretChunk: %v", err)
+	}
+	if len(verdict.failed) != 1 || strings.Contains(verdict.lastResult, "Zx9qL2mP8vR4tY7wK1nB5cD3fG6hJ0sA") {
+		t.Errorf("got failed %v and response %q, want the response kept with the candidate masked", verdict.failed, verdict.lastResult)
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/wenjielee1/github-bot/models"
+	"github.com/wenjielee1/github-bot/utils"
+)
+
+// SecretsCheckName is the check name secret findings are recorded under.
+const SecretsCheckName = "secrets"
+
+// Exit codes of a single GitHub Actions run, so that branch protection can require the job.
+const (
+	ExitClean      = 0 // No findings at or above the severity threshold and every check ran.
+	ExitFindings   = 1 // At least one finding at or above the severity threshold.
+	ExitInfraError = 2 // A check could not run, e.g. because GitHub or the LLM was unavailable.
+)
+
+// DefaultFailOn is the severity threshold of findings that fail the run when the repository does not set one.
+const DefaultFailOn = models.SeverityMedium
+
+// FailOnNone is the severity threshold that never fails the run on findings.
+const FailOnNone = "none"
+
+// severityRanks orders the severities from least to most severe.
+var severityRanks = map[string]int{
+	models.SeverityLow:    1,
+	models.SeverityMedium: 2,
+	models.SeverityHigh:   3,
+}
+
+// runResultsKey is the context key of the RunResults of an event.
+type runResultsKey struct{}
+
+// RunResults collects the findings of every check that ran for an event, so that they can be
+// exported once the event is handled. It is safe for concurrent use.
+type RunResults struct {
+	mu       sync.Mutex
+	findings []models.Finding
+	errors   []error
+	failOn   string
+}
+
+// NewRunResults creates an empty result collection.
+func NewRunResults() *RunResults {
+	return &RunResults{}
+}
+
+// WithRunResults returns a context that checks record their findings in.
+func WithRunResults(ctx context.Context, results *RunResults) context.Context {
+	return context.WithValue(ctx, runResultsKey{}, results)
+}
+
+// RecordFindings adds findings to the results of the context, if it carries any.
+func RecordFindings(ctx context.Context, findings ...models.Finding) {
+	results, ok := ctx.Value(runResultsKey{}).(*RunResults)
+	if !ok || results == nil {
+		return
+	}
+	results.mu.Lock()
+	defer results.mu.Unlock()
+	// Messages are masked with the event's redactor, which is gone by the time the findings are exported
+	for _, finding := range findings {
+		finding.Message = utils.Redact(ctx, finding.Message)
+		results.findings = append(results.findings, finding)
+	}
+}
+
+// RecordError notes that a check could not run completely, if the context carries results.
+func RecordError(ctx context.Context, err error) {
+	results, ok := ctx.Value(runResultsKey{}).(*RunResults)
+	if !ok || results == nil {
+		return
+	}
+	results.mu.Lock()
+	defer results.mu.Unlock()
+	results.errors = append(results.errors, err)
+}
+
+// SetFailOn sets the severity threshold of the repository the event belongs to.
+func (r *RunResults) SetFailOn(failOn string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failOn = failOn
+}
+
+// Errors returns the recorded errors.
+func (r *RunResults) Errors() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]error(nil), r.errors...)
+}
+
+// ExitCode returns the exit code of the run. Findings at or above the severity threshold take precedence
+// over errors, as they fail the run whatever the other checks would have found. A non-empty failOn
+// overrides the threshold of the repository.
+func (r *RunResults) ExitCode(failOn string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if failOn == "" {
+		failOn = r.failOn
+	}
+	if failOn == "" {
+		failOn = DefaultFailOn
+	}
+	for _, finding := range r.findings {
+		if AtOrAbove(finding.Severity, failOn) {
+			return ExitFindings
+		}
+	}
+	if len(r.errors) > 0 {
+		return ExitInfraError
+	}
+	return ExitClean
+}
+
+// ValidFailOn reports whether a severity threshold is one of the severities or "none".
+func ValidFailOn(failOn string) bool {
+	_, ok := severityRanks[failOn]
+	return ok || failOn == FailOnNone
+}
+
+// AtOrAbove reports whether a severity is at or above a severity threshold. Nothing is above "none".
+func AtOrAbove(severity, failOn string) bool {
+	threshold, ok := severityRanks[failOn]
+	return ok && severityRanks[severity] >= threshold
+}
+
+// Findings returns the recorded findings.
+func (r *RunResults) Findings() []models.Finding {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]models.Finding(nil), r.findings...)
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/wenjielee1/github-bot/models"
+)
+
+func TestAtOrAbove(t *testing.T) {
+	tests := []struct {
+		severity string
+		failOn   string
+		want     bool
+	}{
+		{models.SeverityHigh, models.SeverityHigh, true},
+		{models.SeverityMedium, models.SeverityHigh, false},
+		{models.SeverityHigh, models.SeverityMedium, true},
+		{models.SeverityLow, models.SeverityMedium, false},
+		{models.SeverityLow, models.SeverityLow, true},
+		{models.SeverityHigh, FailOnNone, false},
+		{models.SeverityHigh, "critical", false},
+		{"", models.SeverityLow, false},
+	}
+	for _, test := range tests {
+		if got := AtOrAbove(test.severity, test.failOn); got != test.want {
+			t.Errorf("AtOrAbove(%q, %q) = %v, want %v", test.severity, test.failOn, got, test.want)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		findings []string // The severities of the findings.
+		errored  bool     // Whether a check could not run.
+		repo     string   // The repository's secrets.fail_on.
+		override string   // The --fail-on flag.
+		want     int
+	}{
+		{name: "nothing", want: ExitClean},
+		{name: "medium finding, default threshold", findings: []string{models.SeverityMedium}, want: ExitFindings},
+		{name: "low finding, default threshold", findings: []string{models.SeverityLow}, want: ExitClean},
+		{name: "error only", errored: true, want: ExitInfraError},
+		{name: "finding takes precedence over errors", findings: []string{models.SeverityHigh}, errored: true, want: ExitFindings},
+		{name: "finding below threshold with errors", findings: []string{models.SeverityLow}, errored: true, want: ExitInfraError},
+		{name: "repository raises the threshold", findings: []string{models.SeverityMedium}, repo: models.SeverityHigh, want: ExitClean},
+		{name: "repository lowers the threshold", findings: []string{models.SeverityLow}, repo: models.SeverityLow, want: ExitFindings},
+		{name: "repository never fails", findings: []string{models.SeverityHigh}, repo: FailOnNone, want: ExitClean},
+		{name: "flag overrides the repository", findings: []string{models.SeverityMedium}, repo: FailOnNone, override: models.SeverityMedium, want: ExitFindings},
+		{name: "flag never fails", findings: []string{models.SeverityHigh}, repo: models.SeverityLow, override: FailOnNone, errored: true, want: ExitInfraError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results := NewRunResults()
+			results.SetFailOn(test.repo)
+			ctx := WithRunResults(context.Background(), results)
+			for _, severity := range test.findings {
+				RecordFindings(ctx, models.Finding{Check: SecretsCheckName, RuleID: "rule", Severity: severity})
+			}
+			if test.errored {
+				RecordError(ctx, errors.New("LLM unavailable"))
+			}
+			if got := results.ExitCode(test.override); got != test.want {
+				t.Errorf("got exit code %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidFailOn(t *testing.T) {
+	for _, failOn := range []string{models.SeverityHigh, models.SeverityMedium, models.SeverityLow, FailOnNone} {
+		if !ValidFailOn(failOn) {
+			t.Errorf("ValidFailOn(%q) = false, want true", failOn)
+		}
+	}
+	for _, failOn := range []string{"", "critical", "HIGH"} {
+		if ValidFailOn(failOn) {
+			t.Errorf("ValidFailOn(%q) = true, want false", failOn)
+		}
+	}
+}
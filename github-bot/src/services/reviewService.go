@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/wenjielee1/github-bot/models"
+	"github.com/wenjielee1/github-bot/utils"
+)
+
+// SubmitReview posts comments on lines, or ranges of lines, of a pull request as a single review of its head commit, so that reviewers
+// get one notification. The lines are mapped to positions in the diff using the patches of the pull request's files.
+// Comments on lines that are not part of the diff, such as lines a later commit changed again, are listed in the
+// review body instead. Secrets in the review are masked.
+func SubmitReview(ctx context.Context, client *github.Client, owner, repo string, pr *models.PullRequest, files []*github.CommitFile, body string, comments []models.ReviewComment) error {
+	// Parse the hunks of every file once
+	hunks := make(map[string][]utils.Hunk, len(files))
+	for _, file := range files {
+		if file.GetPatch() == "" {
+			continue
+		}
+		fileHunks, err := utils.ParsePatch(file.GetPatch())
+		if err != nil {
+			log.Printf("Error parsing patch of %s in PR #%d: %v", file.GetFilename(), pr.Number, err)
+			continue
+		}
+		hunks[file.GetFilename()] = fileHunks
+	}
+
+	var drafts []*github.DraftReviewComment
+	var unplaced strings.Builder
+	for _, comment := range comments {
+		// Ranges are anchored by line numbers, single lines by their position in the diff
+		if comment.StartLine > 0 && comment.StartLine < comment.Line {
+			if !utils.DiffRange(hunks[comment.File], comment.StartLine, comment.Line) {
+				unplaced.WriteString(fmt.Sprintf("\n- `%s` lines %d-%d: %s", comment.File, comment.StartLine, comment.Line, comment.Body))
+				continue
+			}
+			drafts = append(drafts, &github.DraftReviewComment{
+				Path:      github.String(comment.File),
+				StartLine: github.Int(comment.StartLine),
+				Line:      github.Int(comment.Line),
+				StartSide: github.String("RIGHT"),
+				Side:      github.String("RIGHT"),
+				Body:      github.String(utils.Redact(ctx, comment.Body)),
+			})
+			continue
+		}
+		position, ok := utils.DiffPosition(hunks[comment.File], comment.Line)
+		if !ok {
+			unplaced.WriteString(fmt.Sprintf("\n- `%s` line %d: %s", comment.File, comment.Line, comment.Body))
+			continue
+		}
+		drafts = append(drafts, &github.DraftReviewComment{
+			Path:     github.String(comment.File),
+			Position: github.Int(position),
+			Body:     github.String(utils.Redact(ctx, comment.Body)),
+		})
+	}
+	if unplaced.Len() > 0 {
+		body += "\n\nOn lines that are no longer part of the diff:" + unplaced.String()
+	}
+	if len(drafts) == 0 && strings.TrimSpace(body) == "" {
+		return nil
+	}
+
+	review := &github.PullRequestReviewRequest{
+		Body:     github.String(utils.Redact(ctx, body)),
+		Event:    github.String("COMMENT"),
+		Comments: drafts,
+	}
+	// Positions refer to the diff of the head commit the files were listed at
+	if pr.Head.SHA != "" {
+		review.CommitID = github.String(pr.Head.SHA)
+	}
+	if _, _, err := client.PullRequests.CreateReview(ctx, owner, repo, pr.Number, review); err != nil {
+		return fmt.Errorf("error submitting review on PR #%d: %w", pr.Number, err)
+	}
+	log.Printf("Submitted review with %d inline comments on PR #%d", len(drafts), pr.Number)
+	return nil
+}
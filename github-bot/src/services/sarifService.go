@@ -0,0 +1,143 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/wenjielee1/github-bot/models"
+	"github.com/wenjielee1/github-bot/utils"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	// sarifFingerprintKey is the partial fingerprint findings are tracked by across runs.
+	sarifFingerprintKey = "jambuFingerprint/v1"
+)
+
+// FindingRules returns every rule findings can be reported for, in a stable order.
+func FindingRules() []models.FindingRule {
+	var rules []models.FindingRule
+	for _, rule := range SecretRules {
+		rules = append(rules, models.FindingRule{ID: rule.ID, Name: rule.Description, Description: rule.Description, Severity: rule.Severity})
+	}
+	rules = append(rules, models.FindingRule{ID: HighEntropyRuleID, Name: "High entropy string", Description: "High entropy string confirmed as a secret", Severity: models.SeverityLow})
+	return rules
+}
+
+// SecretFindingResults converts secret findings into the findings shared by every check.
+func SecretFindingResults(findings []models.SecretFinding) []models.Finding {
+	var results []models.Finding
+	for _, finding := range findings {
+		results = append(results, models.Finding{
+			Check:       SecretsCheckName,
+			RuleID:      finding.RuleID,
+			Severity:    finding.Severity,
+			Message:     fmt.Sprintf("Possible %s added in commit %s.", finding.Description, finding.Commit),
+			File:        finding.File,
+			Line:        finding.Line,
+			Fingerprint: finding.Fingerprint,
+		})
+	}
+	return results
+}
+
+// sarifLevel maps a severity to a SARIF level.
+func sarifLevel(severity string) string {
+	switch severity {
+	case models.SeverityHigh:
+		return "error"
+	case models.SeverityMedium:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// sarifSecuritySeverity maps a severity to the CVSS-like score GitHub code scanning ranks security alerts by.
+func sarifSecuritySeverity(severity string) string {
+	switch severity {
+	case models.SeverityHigh:
+		return "8.0"
+	case models.SeverityMedium:
+		return "5.0"
+	default:
+		return "2.0"
+	}
+}
+
+// BuildSarif converts findings into a SARIF 2.1.0 log with a single run of the bot.
+// Rules are listed in the order of FindingRules, so rule indices are stable across runs.
+func BuildSarif(findings []models.Finding) *models.SarifLog {
+	driver := models.SarifDriver{
+		Name:           "JambuBot",
+		Version:        utils.GetBotVersion(),
+		InformationURI: "https://github.com/wenjielee1/github-bot",
+	}
+	ruleIndex := map[string]int{}
+	for _, rule := range FindingRules() {
+		ruleIndex[rule.ID] = len(driver.Rules)
+		driver.Rules = append(driver.Rules, models.SarifReportingDescriptor{
+			ID:                   rule.ID,
+			Name:                 rule.Name,
+			ShortDescription:     models.SarifMessage{Text: rule.Description},
+			DefaultConfiguration: models.SarifRuleConfiguration{Level: sarifLevel(rule.Severity)},
+			Properties: map[string]interface{}{
+				"tags":              []string{"security", "secrets"},
+				"security-severity": sarifSecuritySeverity(rule.Severity),
+			},
+		})
+	}
+
+	results := []models.SarifResult{}
+	for _, finding := range findings {
+		index, ok := ruleIndex[finding.RuleID]
+		if !ok {
+			// Findings of rules that are not listed still need a descriptor
+			index = len(driver.Rules)
+			ruleIndex[finding.RuleID] = index
+			driver.Rules = append(driver.Rules, models.SarifReportingDescriptor{
+				ID:                   finding.RuleID,
+				ShortDescription:     models.SarifMessage{Text: finding.RuleID},
+				DefaultConfiguration: models.SarifRuleConfiguration{Level: sarifLevel(finding.Severity)},
+			})
+		}
+
+		location := models.SarifPhysicalLocation{
+			ArtifactLocation: models.SarifArtifactLocation{URI: finding.File, URIBaseID: "%SRCROOT%"},
+		}
+		if finding.Line > 0 {
+			location.Region = &models.SarifRegion{StartLine: finding.Line}
+		}
+		result := models.SarifResult{
+			RuleID:    finding.RuleID,
+			RuleIndex: index,
+			Level:     sarifLevel(finding.Severity),
+			Message:   models.SarifMessage{Text: utils.DefaultRedactor.Redact(finding.Message)},
+			Locations: []models.SarifLocation{{PhysicalLocation: location}},
+		}
+		if finding.Fingerprint != "" {
+			result.PartialFingerprints = map[string]string{sarifFingerprintKey: finding.Fingerprint}
+		}
+		results = append(results, result)
+	}
+
+	return &models.SarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []models.SarifRun{{Tool: models.SarifTool{Driver: driver}, Results: results}},
+	}
+}
+
+// WriteSarifFile writes findings to a SARIF 2.1.0 file, which GitHub code scanning can import as alerts.
+func WriteSarifFile(path string, findings []models.Finding) error {
+	data, err := json.MarshalIndent(BuildSarif(findings), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling SARIF: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("error writing SARIF file %s: %w", path, err)
+	}
+	return nil
+}
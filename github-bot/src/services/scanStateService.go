@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/google/go-github/v41/github"
+	"github.com/wenjielee1/github-bot/models"
+)
+
+// scanStatePattern matches the hidden marker the scan state is stored in. The state is base64 encoded,
+// so that its JSON cannot end the HTML comment early.
+var scanStatePattern = regexp.MustCompile(`<!-- jambu:secrets-state ([A-Za-z0-9+/=]+) -->`)
+
+// LoadSecretScanState reads the scan state from the secrets check run of a commit, usually the head of the
+// pull request before a push. It returns nil if the commit has no completed check run of the bot's App with a state.
+func LoadSecretScanState(ctx context.Context, client *github.Client, owner, repo, sha string) *models.SecretScanState {
+	runs, _, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha, &github.ListCheckRunsOptions{
+		CheckName: github.String(SecretsCheckRunName),
+		Status:    github.String("completed"),
+		Filter:    github.String("latest"),
+	})
+	if err != nil {
+		log.Printf("Error listing check runs of %s, scanning every commit: %v", sha, err)
+		return nil
+	}
+	for _, run := range runs.CheckRuns {
+		if !ownCheckRun(ctx, run) {
+			log.Printf("Ignoring check run %d of %s, it was not created by this App", run.GetID(), sha)
+			continue
+		}
+		state, err := ParseSecretScanState(run.GetOutput().GetText())
+		if err != nil {
+			log.Printf("Error reading the scan state of check run %d, scanning every commit: %v", run.GetID(), err)
+			return nil
+		}
+		if state != nil {
+			return state
+		}
+	}
+	return nil
+}
+
+// FormatSecretScanState renders the scan state as a hidden marker for the text of the secrets check run.
+// The text of a check run is public on public repositories, so the state only names commits, never findings.
+func FormatSecretScanState(state *models.SecretScanState) (string, error) {
+	data, err := json.Marshal(models.SecretScanState{Commits: state.Commits})
+	if err != nil {
+		return "", fmt.Errorf("error marshalling scan state: %w", err)
+	}
+	return fmt.Sprintf("<!-- jambu:secrets-state %s -->", base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// ParseSecretScanState reads the scan state from the text of a check run. It returns nil if there is none.
+func ParseSecretScanState(text string) (*models.SecretScanState, error) {
+	match := scanStatePattern.FindStringSubmatch(text)
+	if match == nil {
+		return nil, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(match[1])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding scan state: %w", err)
+	}
+	var state models.SecretScanState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("error unmarshalling scan state: %w", err)
+	}
+	return &state, nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/wenjielee1/github-bot/models"
+)
+
+// StreamError is an error event embedded in a streamed gen_tables response.
+type StreamError struct {
+	Column  string // The output column the error was reported for, if any.
+	Message string // The error reported by the server.
+}
+
+// Error returns the error message, prefixed with the column it was reported for.
+func (e *StreamError) Error() string {
+	if e.Column != "" {
+		return fmt.Sprintf("stream error in column %s: %s", e.Column, e.Message)
+	}
+	return "stream error: " + e.Message
+}
+
+// StreamDecoder decodes the server-sent events of a streamed gen_tables response into typed StreamResponse events.
+// Lines of any length are supported, and multi-line data fields are joined with newlines as per the SSE specification.
+type StreamDecoder struct {
+	reader *bufio.Reader
+	done   bool
+}
+
+// NewStreamDecoder creates a decoder reading server-sent events from r.
+func NewStreamDecoder(r io.Reader) *StreamDecoder {
+	return &StreamDecoder{reader: bufio.NewReader(r)}
+}
+
+// Next returns the next event of the stream. It returns io.EOF once the stream ends or sends [DONE],
+// and a *StreamError for error events.
+func (d *StreamDecoder) Next() (*models.StreamResponse, error) {
+	for !d.done {
+		eventType, data, err := d.readEvent()
+		if err != nil {
+			return nil, err
+		}
+		if data == "" {
+			continue
+		}
+		if data == "[DONE]" {
+			d.done = true
+			break
+		}
+
+		var event models.StreamResponse
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			if eventType == "error" {
+				return nil, &StreamError{Message: data}
+			}
+			return nil, fmt.Errorf("error unmarshaling event: %w", err)
+		}
+		if eventType == "error" || rawPresent(event.Error) || rawPresent(event.Detail) {
+			return nil, &StreamError{Column: event.OutputColumnName, Message: streamErrorMessage(event, data)}
+		}
+		return &event, nil
+	}
+	return nil, io.EOF
+}
+
+// readEvent reads the lines of one event up to the blank line that dispatches it,
+// returning its event type and data. It returns io.EOF if the stream ends before any data.
+func (d *StreamDecoder) readEvent() (string, string, error) {
+	var eventType string
+	var data []string
+	for {
+		line, err := d.reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", "", fmt.Errorf("error reading response data: %w", err)
+		}
+		atEOF := err == io.EOF
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if len(data) > 0 || eventType != "" {
+				return eventType, strings.Join(data, "\n"), nil
+			}
+			if atEOF {
+				d.done = true
+				return "", "", io.EOF
+			}
+			continue
+		}
+
+		// Lines starting with a colon are comments, used as keep-alives
+		if !strings.HasPrefix(line, ":") {
+			field, value := line, ""
+			if i := strings.IndexByte(line, ':'); i >= 0 {
+				field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+			}
+			switch field {
+			case "event":
+				eventType = value
+			case "data":
+				data = append(data, value)
+			}
+		}
+
+		if atEOF {
+			d.done = true
+			if len(data) == 0 {
+				return "", "", io.EOF
+			}
+			return eventType, strings.Join(data, "\n"), nil
+		}
+	}
+}
+
+// rawPresent reports whether a field of an event was set, as servers send absent fields as null.
+func rawPresent(raw json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(raw)
+	return len(trimmed) > 0 && !bytes.Equal(trimmed, []byte("null"))
+}
+
+// streamErrorMessage extracts the most specific error message from an error event.
+func streamErrorMessage(event models.StreamResponse, data string) string {
+	for _, raw := range []json.RawMessage{event.Error, event.Detail} {
+		if !rawPresent(raw) {
+			continue
+		}
+		var message string
+		if err := json.Unmarshal(raw, &message); err == nil {
+			return message
+		}
+		return string(bytes.TrimSpace(raw))
+	}
+	return data
+}
+
+// CollectColumns reads an entire streamed response in a single pass and returns the content,
+// usage and references of every output column, keyed by column name.
+func CollectColumns(r io.Reader) (map[string]*models.ColumnResult, error) {
+	decoder := NewStreamDecoder(r)
+	results := map[string]*models.ColumnResult{}
+	contents := map[string]*strings.Builder{}
+
+	for {
+		event, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if event.OutputColumnName == "" {
+			continue
+		}
+
+		result, ok := results[event.OutputColumnName]
+		if !ok {
+			result = &models.ColumnResult{}
+			results[event.OutputColumnName] = result
+			contents[event.OutputColumnName] = &strings.Builder{}
+		}
+		for _, choice := range event.Choices {
+			contents[event.OutputColumnName].WriteString(choice.Message.Content)
+		}
+		if event.Usage != nil {
+			result.Usage = *event.Usage
+		}
+		if rawPresent(event.References) {
+			result.References = event.References
+		}
+	}
+
+	for column, content := range contents {
+		results[column].Content = content.String()
+	}
+	return results, nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStreamDecoderErrorFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"no error fields", `{"output_column_name":"A","choices":[{"message":{"content":"hi"}}]}`, ""},
+		{"null error and detail", `{"output_column_name":"A","error":null,"detail":null,"choices":[]}`, ""},
+		{"error message", `{"output_column_name":"A","error":"quota exceeded"}`, "stream error in column A: quota exceeded"},
+		{"error object", `{"detail":{"msg":"bad"}}`, `stream error: {"msg":"bad"}`},
+	}
+	for _, test := range tests {
+		decoder := NewStreamDecoder(strings.NewReader("data: " + test.data + "\n\ndata: [DONE]\n\n"))
+		_, err := decoder.Next()
+		var streamErr *StreamError
+		switch {
+		case test.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		case test.wantErr != "" && !errors.As(err, &streamErr):
+			t.Errorf("%s: got %v, want a StreamError", test.name, err)
+		case test.wantErr != "" && err.Error() != test.wantErr:
+			t.Errorf("%s: got %q, want %q", test.name, err.Error(), test.wantErr)
+		}
+		if test.wantErr == "" {
+			if _, err := decoder.Next(); err != io.EOF {
+				t.Errorf("%s: got %v after the event, want io.EOF", test.name, err)
+			}
+		}
+	}
+}
+
+// chunkEvent renders an event streaming content for a column.
+func chunkEvent(column, content string) string {
+	return `{"output_column_name":"` + column + `","choices":[{"message":{"content":"` + content + `"}}]}`
+}
+
+func TestCollectColumns(t *testing.T) {
+	long := strings.Repeat("x", 200<<10)
+	tests := []struct {
+		name   string
+		stream string
+		want   map[string]string
+	}{
+		{
+			name:   "line longer than 64KB",
+			stream: "data: " + chunkEvent("A", long) + "\n\ndata: [DONE]\n\n",
+			want:   map[string]string{"A": long},
+		},
+		{
+			name:   "multi-line data",
+			stream: "data: {\"output_column_name\":\"A\",\ndata: \"choices\":[{\"message\":{\"content\":\"joined\"}}]}\n\n",
+			want:   map[string]string{"A": "joined"},
+		},
+		{
+			name:   "columns interleaved with comments and CRLF",
+			stream: ": keep-alive\r\n\r\ndata: " + chunkEvent("A", "Hel") + "\r\n\r\ndata: " + chunkEvent("B", "{}") + "\r\n\r\ndata: " + chunkEvent("A", "lo") + "\r\n\r\n",
+			want:   map[string]string{"A": "Hello", "B": "{}"},
+		},
+		{
+			name:   "events after [DONE]",
+			stream: "data: " + chunkEvent("A", "kept") + "\n\ndata: [DONE]\n\ndata: " + chunkEvent("A", " ignored") + "\n\n",
+			want:   map[string]string{"A": "kept"},
+		},
+		{
+			name:   "partial final frame",
+			stream: "data: " + chunkEvent("A", "first") + "\n\ndata: " + chunkEvent("A", " last"),
+			want:   map[string]string{"A": "first last"},
+		},
+		{
+			name:   "empty stream",
+			stream: "",
+			want:   map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := CollectColumns(strings.NewReader(test.stream))
+			if err != nil {
+				t.Fatalf("CollectColumns: %v", err)
+			}
+			if len(results) != len(test.want) {
+				t.Fatalf("got %d columns, want %d", len(results), len(test.want))
+			}
+			for column, want := range test.want {
+				if result, ok := results[column]; !ok || result.Content != want {
+					t.Errorf("column %s has %d bytes of content, want %d", column, len(results[column].Content), len(want))
+				}
+			}
+		})
+	}
+}
+
+func TestCollectColumnsUsageAndErrors(t *testing.T) {
+	stream := "data: " + chunkEvent("A", "hi") + "\n\n" +
+		`data: {"output_column_name":"A","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5},"references":null}` + "\n\n"
+	results, err := CollectColumns(strings.NewReader(stream))
+	if err != nil {
+		t.Fatalf("CollectColumns: %v", err)
+	}
+	if results["A"].Usage.TotalTokens != 5 || results["A"].References != nil {
+		t.Errorf("got %+v, want the usage of the final event and no references", results["A"])
+	}
+
+	_, err = CollectColumns(strings.NewReader("data: " + chunkEvent("A", "hi") + "\n\nevent: error\ndata: upstream timed out\n\n"))
+	var streamErr *StreamError
+	if !errors.As(err, &streamErr) || streamErr.Message != "upstream timed out" {
+		t.Errorf("got %v, want the error event", err)
+	}
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wenjielee1/github-bot/models"
+)
+
+// defaultUsageStorePath is where token usage is recorded when TRIAGE_BOT_USAGE_STORE is not set.
+const defaultUsageStorePath = ".jambubot/usage.json"
+
+// ErrBudgetExceeded is returned instead of generating a response once a repository has used up its daily token budget.
+var ErrBudgetExceeded = errors.New("daily token budget exceeded")
+
+// UsageStore records token usage per repository, check and UTC day in a local JSON file.
+// It is safe for concurrent use within a process.
+type UsageStore struct {
+	path  string
+	clock func() time.Time
+
+	mu sync.Mutex
+}
+
+var (
+	defaultUsageStore     *UsageStore
+	defaultUsageStoreOnce sync.Once
+)
+
+// DefaultUsageStore returns the process-wide usage store at TRIAGE_BOT_USAGE_STORE, or .jambubot/usage.json.
+func DefaultUsageStore() *UsageStore {
+	defaultUsageStoreOnce.Do(func() {
+		defaultUsageStore = NewUsageStore(getEnvString("TRIAGE_BOT_USAGE_STORE", defaultUsageStorePath))
+	})
+	return defaultUsageStore
+}
+
+// NewUsageStore creates a usage store backed by the file at path. The file is created on first write.
+func NewUsageStore(path string) *UsageStore {
+	return &UsageStore{path: path, clock: time.Now}
+}
+
+// today returns the current UTC day in the format used as ledger key.
+func (s *UsageStore) today() string {
+	return s.clock().UTC().Format("2006-01-02")
+}
+
+// Record adds the token usage of one generated column to today's usage of a repository's check.
+func (s *UsageStore) Record(repo, check string, usage models.Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ledger, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	day := s.today()
+	if ledger.Usage[repo] == nil {
+		ledger.Usage[repo] = map[string]map[string]*models.UsageRecord{}
+	}
+	if ledger.Usage[repo][day] == nil {
+		ledger.Usage[repo][day] = map[string]*models.UsageRecord{}
+	}
+	record := ledger.Usage[repo][day][check]
+	if record == nil {
+		record = &models.UsageRecord{}
+		ledger.Usage[repo][day][check] = record
+	}
+
+	total := usage.TotalTokens
+	if total == 0 {
+		total = usage.PromptTokens + usage.CompletionTokens
+	}
+	record.Requests++
+	record.PromptTokens += usage.PromptTokens
+	record.CompletionTokens += usage.CompletionTokens
+	record.TotalTokens += total
+
+	return s.save(ledger)
+}
+
+// TodayTotal returns the total tokens a repository has used today across all checks.
+func (s *UsageStore) TodayTotal(repo string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ledger, err := s.load()
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, record := range ledger.Usage[repo][s.today()] {
+		total += record.TotalTokens
+	}
+	return total, nil
+}
+
+// MarkBudgetNotice records that the budget notice was posted on an issue or pull request today.
+// It returns false if the notice had already been posted, so that it is only posted once.
+func (s *UsageStore) MarkBudgetNotice(repo string, number int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ledger, err := s.load()
+	if err != nil {
+		return false, err
+	}
+	key := fmt.Sprintf("%s#%d@%s", repo, number, s.today())
+	if ledger.Notices[key] {
+		return false, nil
+	}
+	ledger.Notices[key] = true
+	return true, s.save(ledger)
+}
+
+// Report writes a table of the token usage of the last days, most recent first.
+// An empty repo reports every repository.
+func (s *UsageStore) Report(w io.Writer, repo string, days int) error {
+	s.mu.Lock()
+	ledger, err := s.load()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	since := s.clock().UTC().AddDate(0, 0, -days+1).Format("2006-01-02")
+	type row struct {
+		day, repo, check string
+		record           *models.UsageRecord
+	}
+	var rows []row
+	for repoName, byDay := range ledger.Usage {
+		if repo != "" && repoName != repo {
+			continue
+		}
+		for day, byCheck := range byDay {
+			if day < since {
+				continue
+			}
+			for check, record := range byCheck {
+				rows = append(rows, row{day, repoName, check, record})
+			}
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].day != rows[j].day {
+			return rows[i].day > rows[j].day
+		}
+		if rows[i].repo != rows[j].repo {
+			return rows[i].repo < rows[j].repo
+		}
+		return rows[i].check < rows[j].check
+	})
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "DAY\tREPOSITORY\tCHECK\tREQUESTS\tPROMPT\tCOMPLETION\tTOTAL")
+	totals := models.UsageRecord{}
+	for _, r := range rows {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%d\t%d\t%d\t%d\n", r.day, r.repo, r.check, r.record.Requests, r.record.PromptTokens, r.record.CompletionTokens, r.record.TotalTokens)
+		totals.Requests += r.record.Requests
+		totals.PromptTokens += r.record.PromptTokens
+		totals.CompletionTokens += r.record.CompletionTokens
+		totals.TotalTokens += r.record.TotalTokens
+	}
+	fmt.Fprintf(table, "\t\tTOTAL\t%d\t%d\t%d\t%d\n", totals.Requests, totals.PromptTokens, totals.CompletionTokens, totals.TotalTokens)
+	return table.Flush()
+}
+
+// load reads the ledger from disk, returning an empty ledger if the file does not exist yet.
+func (s *UsageStore) load() (*models.UsageLedger, error) {
+	ledger := &models.UsageLedger{}
+	data, err := os.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading usage store %s: %w", s.path, err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, ledger); err != nil {
+			return nil, fmt.Errorf("error unmarshaling usage store %s: %w", s.path, err)
+		}
+	}
+	if ledger.Usage == nil {
+		ledger.Usage = map[string]map[string]map[string]*models.UsageRecord{}
+	}
+	if ledger.Notices == nil {
+		ledger.Notices = map[string]bool{}
+	}
+	return ledger, nil
+}
+
+// save atomically replaces the ledger on disk.
+func (s *UsageStore) save(ledger *models.UsageLedger) error {
+	data, err := json.MarshalIndent(ledger, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling usage store: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("error creating usage store directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing usage store %s: %w", s.path, err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// MeteredProvider wraps an LLMProvider, recording the token usage of every generated column
+// and refusing to generate once the repository has used up its daily token budget.
+type MeteredProvider struct {
+	LLMProvider
+	store       *UsageStore
+	repo        string
+	dailyBudget int
+}
+
+// NewMeteredProvider wraps provider, accounting usage to repo. A dailyBudget of 0 disables the cap.
+func NewMeteredProvider(provider LLMProvider, store *UsageStore, repo string, dailyBudget int) *MeteredProvider {
+	return &MeteredProvider{LLMProvider: provider, store: store, repo: repo, dailyBudget: dailyBudget}
+}
+
+// Generate checks the budget, generates the columns with the wrapped provider and records their usage.
+func (p *MeteredProvider) Generate(ctx context.Context, inputs map[string]string, outputColumns ...string) (map[string]models.ColumnResult, error) {
+	if p.dailyBudget > 0 {
+		used, err := p.store.TodayTotal(p.repo)
+		if err != nil {
+			log.Printf("Error reading usage of %s, not enforcing budget: %v", p.repo, err)
+		} else if used >= p.dailyBudget {
+			return nil, fmt.Errorf("%w: %s used %d of %d tokens today", ErrBudgetExceeded, p.repo, used, p.dailyBudget)
+		}
+	}
+
+	outputs, err := p.LLMProvider.Generate(ctx, inputs, outputColumns...)
+	if err != nil {
+		return nil, err
+	}
+	for column, result := range outputs {
+		if err := p.store.Record(p.repo, CheckForColumn(column), result.Usage); err != nil {
+			log.Printf("Error recording usage of %s: %v", p.repo, err)
+		}
+	}
+	return outputs, nil
+}
+
+// DailyBudget returns the effective daily token budget of a repository: the lower of the operator's cap in
+// TRIAGE_BOT_DAILY_TOKEN_BUDGET and the repository's own budget.daily_tokens, ignoring unset (0) values.
+func DailyBudget(config *models.BotConfig) int {
+	operatorBudget := getEnvInt("TRIAGE_BOT_DAILY_TOKEN_BUDGET", 0)
+	repoBudget := config.Budget.DailyTokens
+	switch {
+	case operatorBudget <= 0:
+		return repoBudget
+	case repoBudget <= 0:
+		return operatorBudget
+	case repoBudget < operatorBudget:
+		return repoBudget
+	default:
+		return operatorBudget
+	}
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"log"
 	"os"
+	"strconv"
 )
 
 const (
@@ -30,3 +31,18 @@ func GetRepoName(defaultValue string) string {
 	}
 	return value
 }
+
+// GetInstallationID returns the fallback installation ID from TRIAGE_BOT_INSTALLATION_ID,
+// used when an event payload does not name the installation. It returns 0 if unset or invalid.
+func GetInstallationID() int64 {
+	value, exists := os.LookupEnv("TRIAGE_BOT_INSTALLATION_ID")
+	if !exists {
+		return 0
+	}
+	installationID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Printf("Error converting INSTALLATION_ID to int64: %v", err)
+		return 0
+	}
+	return installationID
+}
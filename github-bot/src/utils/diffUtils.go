@@ -0,0 +1,276 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v41/github"
+)
+
+// hunkHeaderPattern matches a unified diff hunk header such as "@@ -12,7 +12,9 @@ func main() {".
+// The line counts are optional and default to 1.
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@(.*)$`)
+
+// DiffLine is a single line of a hunk.
+type DiffLine struct {
+	Kind     byte   // '+' for an added line, '-' for a removed line, ' ' for context.
+	Text     string // The content of the line without the leading kind marker.
+	OldLine  int    // The line number in the old file, 0 for added lines.
+	NewLine  int    // The line number in the new file, 0 for removed lines.
+	Position int    // The position of the line in the patch as counted by the GitHub review comments API.
+}
+
+// Hunk is a hunk of a unified diff.
+type Hunk struct {
+	OldStart int        // The first line of the hunk in the old file.
+	OldLines int        // The number of lines of the hunk in the old file.
+	NewStart int        // The first line of the hunk in the new file.
+	NewLines int        // The number of lines of the hunk in the new file.
+	Section  string     // The text after the closing "@@", usually the enclosing function.
+	Position int        // The position of the hunk header in the patch.
+	Lines    []DiffLine // The lines of the hunk.
+}
+
+// ParsePatch parses the patch of a single file, as returned in the patch field of GitHub's commit and
+// pull request file APIs, into its hunks. File headers ("diff --git", "---", "+++") are skipped if present.
+func ParsePatch(patch string) ([]Hunk, error) {
+	var hunks []Hunk
+	var current *Hunk
+	oldLine, newLine := 0, 0
+	position := 0
+
+	lines := strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n")
+	// A trailing newline does not start another line
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	for i, line := range lines {
+		if strings.HasPrefix(line, "@@") {
+			hunk, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			// GitHub counts positions from the line below the first hunk header,
+			// and every later hunk header takes up a position of its own
+			if current != nil {
+				position++
+			}
+			hunk.Position = position
+			hunks = append(hunks, hunk)
+			current = &hunks[len(hunks)-1]
+			oldLine, newLine = current.OldStart, current.NewStart
+			continue
+		}
+		if current == nil {
+			// File headers before the first hunk
+			if strings.HasPrefix(line, "diff ") || strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ ") ||
+				strings.HasPrefix(line, "index ") || strings.HasPrefix(line, "new file") || strings.HasPrefix(line, "deleted file") ||
+				strings.HasPrefix(line, "old mode") || strings.HasPrefix(line, "new mode") || strings.HasPrefix(line, "similarity") ||
+				strings.HasPrefix(line, "rename ") || strings.HasPrefix(line, "Binary files") {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: content before the first hunk header", i+1)
+		}
+
+		position++
+		if line == "" {
+			// Some tools strip the trailing space of empty context lines
+			line = " "
+		}
+		kind := line[0]
+		diffLine := DiffLine{Kind: kind, Text: line[1:], Position: position}
+		switch kind {
+		case '+':
+			diffLine.NewLine = newLine
+			newLine++
+		case '-':
+			diffLine.OldLine = oldLine
+			oldLine++
+		case ' ':
+			diffLine.OldLine = oldLine
+			diffLine.NewLine = newLine
+			oldLine++
+			newLine++
+		case '\\':
+			// "\ No newline at end of file" applies to the previous line and takes up a position
+			continue
+		default:
+			return nil, fmt.Errorf("line %d: unexpected line %q in hunk", i+1, line)
+		}
+		current.Lines = append(current.Lines, diffLine)
+	}
+	return hunks, nil
+}
+
+// parseHunkHeader parses the line ranges of a hunk header.
+func parseHunkHeader(line string) (Hunk, error) {
+	match := hunkHeaderPattern.FindStringSubmatch(line)
+	if match == nil {
+		return Hunk{}, fmt.Errorf("malformed hunk header %q", line)
+	}
+	hunk := Hunk{
+		OldStart: atoiDefault(match[1], 0),
+		OldLines: atoiDefault(match[2], 1),
+		NewStart: atoiDefault(match[3], 0),
+		NewLines: atoiDefault(match[4], 1),
+		Section:  strings.TrimSpace(match[5]),
+	}
+	return hunk, nil
+}
+
+// atoiDefault converts an optional decimal number, returning def if it is empty.
+// The hunk header pattern only matches digits, so the conversion cannot fail otherwise.
+func atoiDefault(value string, def int) int {
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// AddedLines returns the lines a patch adds, with their line numbers in the new file.
+func AddedLines(patch string) ([]DiffLine, error) {
+	hunks, err := ParsePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	var added []DiffLine
+	for _, hunk := range hunks {
+		for _, line := range hunk.Lines {
+			if line.Kind == '+' {
+				added = append(added, line)
+			}
+		}
+	}
+	return added, nil
+}
+
+// DiffPosition returns the position in the patch of a line of the new file, as used by the GitHub review
+// comments API. The returned bool is false if the line is not part of the diff, as only added and context
+// lines of the hunks can be commented on.
+func DiffPosition(hunks []Hunk, newLine int) (int, bool) {
+	for _, hunk := range hunks {
+		if newLine < hunk.NewStart || newLine >= hunk.NewStart+hunk.NewLines {
+			continue
+		}
+		for _, line := range hunk.Lines {
+			if line.Kind != '-' && line.NewLine == newLine {
+				return line.Position, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// DiffRange reports whether the lines from start to end of the new file can be commented on as a range, which the
+// GitHub review comments API only allows within a single hunk.
+func DiffRange(hunks []Hunk, start, end int) bool {
+	for _, hunk := range hunks {
+		if start >= hunk.NewStart && end < hunk.NewStart+hunk.NewLines && start <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDiffFiles splits a raw multi-file git diff, such as the diff of a pull request, into files with the same
+// fields the pull request files API returns: filename, status, patch and line counts. It is used when a pull request
+// has more files than the API lists.
+func ParseDiffFiles(diff string) []*github.CommitFile {
+	var files []*github.CommitFile
+	var current *github.CommitFile
+	var patch strings.Builder
+	inHunks := false
+	oldName := ""
+
+	finish := func() {
+		if current == nil {
+			return
+		}
+		if current.GetFilename() == "" {
+			current.Filename = github.String(oldName)
+		}
+		current.Patch = github.String(strings.TrimSuffix(patch.String(), "\n"))
+		current.Changes = github.Int(current.GetAdditions() + current.GetDeletions())
+		files = append(files, current)
+	}
+
+	diff = strings.TrimSuffix(strings.ReplaceAll(diff, "\r\n", "\n"), "\n")
+	for _, line := range strings.Split(diff, "\n") {
+		if strings.HasPrefix(line, "diff --git ") {
+			finish()
+			current = &github.CommitFile{Status: github.String("modified"), Additions: github.Int(0), Deletions: github.Int(0)}
+			patch.Reset()
+			inHunks = false
+			oldName = ""
+			// The new name is the last " b/" path of the header, used if the file has no ---/+++ lines
+			if i := strings.LastIndex(line, ` "b/`); i >= 0 && strings.HasSuffix(line, `"`) {
+				current.Filename = github.String(diffPath(line[i+1:], "b/"))
+			} else if i := strings.LastIndex(line, " b/"); i >= 0 {
+				current.Filename = github.String(line[i+3:])
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		// File headers come before the first hunk, later lines with the same prefixes are content
+		if !inHunks {
+			switch {
+			case strings.HasPrefix(line, "@@"):
+				inHunks = true
+			case strings.HasPrefix(line, "new file mode"):
+				current.Status = github.String("added")
+				continue
+			case strings.HasPrefix(line, "deleted file mode"):
+				current.Status = github.String("removed")
+				continue
+			case strings.HasPrefix(line, "rename from "):
+				current.Status = github.String("renamed")
+				current.PreviousFilename = github.String(strings.TrimPrefix(line, "rename from "))
+				continue
+			case strings.HasPrefix(line, "--- "):
+				oldName = diffPath(strings.TrimPrefix(line, "--- "), "a/")
+				continue
+			case strings.HasPrefix(line, "+++ "):
+				if name := diffPath(strings.TrimPrefix(line, "+++ "), "b/"); name != "/dev/null" {
+					current.Filename = github.String(name)
+				} else {
+					current.Filename = nil
+				}
+				continue
+			default:
+				continue
+			}
+		}
+
+		switch {
+		case strings.HasPrefix(line, "+"):
+			current.Additions = github.Int(current.GetAdditions() + 1)
+		case strings.HasPrefix(line, "-"):
+			current.Deletions = github.Int(current.GetDeletions() + 1)
+		}
+		patch.WriteString(line + "\n")
+	}
+	finish()
+	return files
+}
+
+// diffPath returns the path named in a file header of a diff without its a/ or b/ prefix. Git quotes paths with
+// special characters, escaping them as in C, and appends a tab to paths with spaces in ---/+++ lines.
+func diffPath(name, prefix string) string {
+	name = strings.TrimSuffix(name, "\t")
+	if len(name) >= 2 && strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`) {
+		if unquoted, err := strconv.Unquote(name); err == nil {
+			name = unquoted
+		}
+	}
+	return strings.TrimPrefix(name, prefix)
+}
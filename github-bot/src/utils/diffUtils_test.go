@@ -0,0 +1,244 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+// multiHunkPatch has two hunks, so that positions continue across the second hunk header.
+const multiHunkPatch = `@@ -1,3 +1,4 @@
+ package main
++import "fmt"
+ 
+ func a() {}
+@@ -10,2 +11,3 @@ func b() {
+ 	x := 1
+-	y := 2
++	y := 3
++	z := 4`
+
+func TestParsePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		want    []Hunk
+		wantErr bool
+	}{
+		{
+			name:  "multiple hunks",
+			patch: multiHunkPatch,
+			want: []Hunk{
+				{OldStart: 1, OldLines: 3, NewStart: 1, NewLines: 4, Position: 0, Lines: []DiffLine{
+					{Kind: ' ', Text: "package main", OldLine: 1, NewLine: 1, Position: 1},
+					{Kind: '+', Text: `import "fmt"`, NewLine: 2, Position: 2},
+					{Kind: ' ', Text: "", OldLine: 2, NewLine: 3, Position: 3},
+					{Kind: ' ', Text: "func a() {}", OldLine: 3, NewLine: 4, Position: 4},
+				}},
+				{OldStart: 10, OldLines: 2, NewStart: 11, NewLines: 3, Section: "func b() {", Position: 5, Lines: []DiffLine{
+					{Kind: ' ', Text: "\tx := 1", OldLine: 10, NewLine: 11, Position: 6},
+					{Kind: '-', Text: "\ty := 2", OldLine: 11, Position: 7},
+					{Kind: '+', Text: "\ty := 3", NewLine: 12, Position: 8},
+					{Kind: '+', Text: "\tz := 4", NewLine: 13, Position: 9},
+				}},
+			},
+		},
+		{
+			name:  "omitted line counts",
+			patch: "@@ -5 +5 @@\n-old\n+new",
+			want: []Hunk{{OldStart: 5, OldLines: 1, NewStart: 5, NewLines: 1, Position: 0, Lines: []DiffLine{
+				{Kind: '-', Text: "old", OldLine: 5, Position: 1},
+				{Kind: '+', Text: "new", NewLine: 5, Position: 2},
+			}}},
+		},
+		{
+			name:  "new file",
+			patch: "@@ -0,0 +1,2 @@\n+a\n+b\n",
+			want: []Hunk{{OldStart: 0, OldLines: 0, NewStart: 1, NewLines: 2, Position: 0, Lines: []DiffLine{
+				{Kind: '+', Text: "a", NewLine: 1, Position: 1},
+				{Kind: '+', Text: "b", NewLine: 2, Position: 2},
+			}}},
+		},
+		{
+			name:  "no newline at end of file",
+			patch: "@@ -1 +1,2 @@\n-a\n\\ No newline at end of file\n+a\n+b\n\\ No newline at end of file",
+			want: []Hunk{{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 2, Position: 0, Lines: []DiffLine{
+				{Kind: '-', Text: "a", OldLine: 1, Position: 1},
+				{Kind: '+', Text: "a", NewLine: 1, Position: 3},
+				{Kind: '+', Text: "b", NewLine: 2, Position: 4},
+			}}},
+		},
+		{
+			name:  "CRLF line endings",
+			patch: "@@ -1,2 +1,2 @@\r\n keep\r\n-old\r\n+new\r\n",
+			want: []Hunk{{OldStart: 1, OldLines: 2, NewStart: 1, NewLines: 2, Position: 0, Lines: []DiffLine{
+				{Kind: ' ', Text: "keep", OldLine: 1, NewLine: 1, Position: 1},
+				{Kind: '-', Text: "old", OldLine: 2, Position: 2},
+				{Kind: '+', Text: "new", NewLine: 2, Position: 3},
+			}}},
+		},
+		{
+			name:  "file headers",
+			patch: "diff --git a/x b/x\nindex 1..2 100644\n--- a/x\n+++ b/x\n@@ -1 +1 @@\n-a\n+b",
+			want: []Hunk{{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1, Position: 0, Lines: []DiffLine{
+				{Kind: '-', Text: "a", OldLine: 1, Position: 1},
+				{Kind: '+', Text: "b", NewLine: 1, Position: 2},
+			}}},
+		},
+		{name: "empty patch", patch: ""},
+		{name: "content before the first hunk", patch: "+a\n@@ -1 +1 @@", wantErr: true},
+		{name: "malformed hunk header", patch: "@@ -a +b @@\n+a", wantErr: true},
+		{name: "unexpected line", patch: "@@ -1 +1 @@\n?a", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := ParsePatch(test.patch)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAddedLines(t *testing.T) {
+	added, err := AddedLines(multiHunkPatch)
+	if err != nil {
+		t.Fatalf("AddedLines: %v", err)
+	}
+	var got []int
+	for _, line := range added {
+		got = append(got, line.NewLine)
+	}
+	if want := []int{2, 12, 13}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got added lines %v, want %v", got, want)
+	}
+}
+
+func TestDiffPosition(t *testing.T) {
+	hunks, err := ParsePatch(multiHunkPatch)
+	if err != nil {
+		t.Fatalf("ParsePatch: %v", err)
+	}
+	tests := []struct {
+		newLine  int
+		position int
+		ok       bool
+	}{
+		{1, 1, true},  // Context line of the first hunk
+		{2, 2, true},  // Added line of the first hunk
+		{4, 4, true},  // Last line of the first hunk
+		{5, 0, false}, // Between the hunks
+		{11, 6, true}, // Context line after the second hunk header
+		{12, 8, true}, // Added line after a removed one
+		{13, 9, true}, // Last line of the patch
+		{14, 0, false},
+		{0, 0, false},
+	}
+	for _, test := range tests {
+		position, ok := DiffPosition(hunks, test.newLine)
+		if position != test.position || ok != test.ok {
+			t.Errorf("line %d: got (%d, %v), want (%d, %v)", test.newLine, position, ok, test.position, test.ok)
+		}
+	}
+}
+
+func TestDiffRange(t *testing.T) {
+	hunks, err := ParsePatch(multiHunkPatch)
+	if err != nil {
+		t.Fatalf("ParsePatch: %v", err)
+	}
+	tests := []struct {
+		start, end int
+		want       bool
+	}{
+		{1, 4, true},
+		{2, 2, true},
+		{11, 13, true},
+		{4, 11, false}, // Spans both hunks
+		{3, 5, false},  // Ends outside the first hunk
+		{13, 12, false},
+	}
+	for _, test := range tests {
+		if got := DiffRange(hunks, test.start, test.end); got != test.want {
+			t.Errorf("lines %d-%d: got %v, want %v", test.start, test.end, got, test.want)
+		}
+	}
+}
+
+func TestParseDiffFiles(t *testing.T) {
+	type want struct {
+		name, previous, status string
+		additions, deletions   int
+		patch                  string
+	}
+	tests := []struct {
+		name string
+		diff string
+		want []want
+	}{
+		{
+			name: "modified and added files",
+			diff: "diff --git a/main.go b/main.go\nindex 1..2 100644\n--- a/main.go\n+++ b/main.go\n@@ -1,2 +1,2 @@\n package main\n-var a = 1\n+var a = 2\n" +
+				"diff --git a/new.go b/new.go\nnew file mode 100644\nindex 0..1\n--- /dev/null\n+++ b/new.go\n@@ -0,0 +1 @@\n+package new\n",
+			want: []want{
+				{"main.go", "", "modified", 1, 1, "@@ -1,2 +1,2 @@\n package main\n-var a = 1\n+var a = 2"},
+				{"new.go", "", "added", 1, 0, "@@ -0,0 +1 @@\n+package new"},
+			},
+		},
+		{
+			name: "deleted file",
+			diff: "diff --git a/gone.go b/gone.go\ndeleted file mode 100644\n--- a/gone.go\n+++ /dev/null\n@@ -1 +0,0 @@\n-package gone\n",
+			want: []want{{"gone.go", "", "removed", 0, 1, "@@ -1 +0,0 @@\n-package gone"}},
+		},
+		{
+			name: "rename without changes",
+			diff: "diff --git a/old/name.go b/new/name.go\nsimilarity index 100%\nrename from old/name.go\nrename to new/name.go\n",
+			want: []want{{"new/name.go", "old/name.go", "renamed", 0, 0, ""}},
+		},
+		{
+			name: "file header lines inside a hunk",
+			diff: "diff --git a/notes.md b/notes.md\n--- a/notes.md\n+++ b/notes.md\n@@ -1,2 +1,2 @@\n--- a/old heading\n+++ b/new heading\n",
+			want: []want{{"notes.md", "", "modified", 1, 1, "@@ -1,2 +1,2 @@\n--- a/old heading\n+++ b/new heading"}},
+		},
+		{
+			name: "quoted path",
+			diff: "diff --git \"a/caf\\303\\251 \\\"menu\\\".txt\" \"b/caf\\303\\251 \\\"menu\\\".txt\"\n--- \"a/caf\\303\\251 \\\"menu\\\".txt\"\n+++ \"b/caf\\303\\251 \\\"menu\\\".txt\"\n@@ -0,0 +1 @@\n+soup\n",
+			want: []want{{"café \"menu\".txt", "", "modified", 1, 0, "@@ -0,0 +1 @@\n+soup"}},
+		},
+		{
+			name: "path with spaces",
+			diff: "diff --git a/a b.txt b/a b.txt\n--- a/a b.txt\t\n+++ b/a b.txt\t\n@@ -1 +1 @@\n-x\n+y\n",
+			want: []want{{"a b.txt", "", "modified", 1, 1, "@@ -1 +1 @@\n-x\n+y"}},
+		},
+		{
+			name: "binary file and CRLF",
+			diff: "diff --git a/logo.png b/logo.png\r\nindex 1..2 100644\r\nBinary files a/logo.png and b/logo.png differ\r\n",
+			want: []want{{"logo.png", "", "modified", 0, 0, ""}},
+		},
+		{
+			name: "empty diff",
+			diff: "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files := ParseDiffFiles(test.diff)
+			if len(files) != len(test.want) {
+				t.Fatalf("got %d files %v, want %d", len(files), files, len(test.want))
+			}
+			for i, file := range files {
+				want := test.want[i]
+				if file.GetFilename() != want.name || file.GetPreviousFilename() != want.previous || file.GetStatus() != want.status {
+					t.Errorf("got %q (from %q) %s, want %q (from %q) %s", file.GetFilename(), file.GetPreviousFilename(), file.GetStatus(), want.name, want.previous, want.status)
+				}
+				if file.GetAdditions() != want.additions || file.GetDeletions() != want.deletions || file.GetChanges() != want.additions+want.deletions {
+					t.Errorf("got +%d -%d (%d), want +%d -%d", file.GetAdditions(), file.GetDeletions(), file.GetChanges(), want.additions, want.deletions)
+				}
+				if file.GetPatch() != want.patch {
+					t.Errorf("got patch %q, want %q", file.GetPatch(), want.patch)
+				}
+			}
+		})
+	}
+}
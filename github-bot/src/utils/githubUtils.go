@@ -4,14 +4,16 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 
 	"github.com/google/go-github/v41/github"
 )
 
 // Gets all labels of a repo
-func GetLabels(ctx context.Context, client *github.Client, owner, repo string)([]*github.Label) {
-	opts := &github.ListOptions{PerPage: 100}
-	repoLabels, _, err := client.Issues.ListLabels(ctx, owner, repo, opts)
+func GetLabels(ctx context.Context, client *github.Client, owner, repo string) []*github.Label {
+	repoLabels, err := ListAll(func(opts *github.ListOptions) ([]*github.Label, *github.Response, error) {
+		return client.Issues.ListLabels(ctx, owner, repo, opts)
+	})
 
 	if err != nil {
 		log.Printf("Error listing labels: %v", err)
@@ -27,8 +29,9 @@ func AddLabels(ctx context.Context, client *github.Client, owner, repo string, i
 	}
 }
 
-// CommentOnIssue comments on a specified GitHub issue.
+// CommentOnIssue comments on a specified GitHub issue. Detected secrets in the comment are masked.
 func CommentOnIssue(ctx context.Context, client *github.Client, owner, repo string, issueNumber int, comment string) {
+	comment = Redact(ctx, comment)
 	commentRequest := &github.IssueComment{Body: &comment}
 	_, _, err := client.Issues.CreateComment(ctx, owner, repo, issueNumber, commentRequest)
 	if err != nil {
@@ -79,7 +82,9 @@ func CreatePriorityLabels(ctx context.Context, client *github.Client, owner, rep
 
 // labelExists checks if a label exists in the specified GitHub repository.
 func labelExists(ctx context.Context, client *github.Client, owner, repo, labelName string) (bool, error) {
-	labels, _, err := client.Issues.ListLabels(ctx, owner, repo, nil)
+	labels, err := ListAll(func(opts *github.ListOptions) ([]*github.Label, *github.Response, error) {
+		return client.Issues.ListLabels(ctx, owner, repo, opts)
+	})
 	if err != nil {
 		return false, err
 	}
@@ -99,3 +104,29 @@ func DeleteComment(ctx context.Context, client *github.Client, owner string, rep
 	}
 	return true, nil
 }
+
+// GetFileContent fetches the content of a file in a repository at the given ref.
+// An empty ref reads from the repository's default branch. The returned bool is false if the file does not exist.
+func GetFileContent(ctx context.Context, client *github.Client, owner, repo, path, ref string) (string, bool, error) {
+	var opts *github.RepositoryContentGetOptions
+	if ref != "" {
+		opts = &github.RepositoryContentGetOptions{Ref: ref}
+	}
+
+	file, _, resp, err := client.Repositories.GetContents(ctx, owner, repo, path, opts)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	if file == nil {
+		return "", false, fmt.Errorf("%s is a directory", path)
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return "", false, err
+	}
+	return content, true, nil
+}
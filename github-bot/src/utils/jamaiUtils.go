@@ -6,7 +6,25 @@ import (
 	"github.com/wenjielee1/github-bot/models"
 )
 
-func GetColumnMessage(columnId string, labels string) []models.Message {
+// greetingInstruction asks the model to open with a pun on the persona's name.
+const greetingInstruction = " Your responses should start with a short pun of your name in the form of a greeting."
+
+// personaPrompt builds a system prompt introducing the bot under the persona's name,
+// followed by the given instructions and any extra instructions from the persona.
+func personaPrompt(persona models.PersonaConfig, role, instructions string, greet bool) string {
+	prompt := fmt.Sprintf("You are %s, %s.%s", persona.Name, role, instructions)
+	if greet && persona.Greeting {
+		prompt += greetingInstruction
+	}
+	if persona.Instructions != "" {
+		prompt += " " + persona.Instructions
+	}
+	return prompt
+}
+
+// GetColumnMessage returns the prompt messages for an output column of the action table,
+// with the repository's labels and the configured persona filled in.
+func GetColumnMessage(columnId string, labels string, persona models.PersonaConfig) []models.Message {
 
 	if columnId == "IssueResponse" {
 
@@ -67,7 +85,7 @@ ${IssueBody}
 		return []models.Message{
 			{
 				Role:    "system",
-				Content: "You are Jambu, a github issue bot. Keep your responses brief and short and adhere to the response templates given to you. You will not mention anything else other than the requested response. Your responses should start with a short pun of your name in the form of a greeting.",
+				Content: personaPrompt(persona, "a github issue bot", " Keep your responses brief and short and adhere to the response templates given to you. You will not mention anything else other than the requested response.", true),
 			},
 			{
 				Role:    "user",
@@ -77,7 +95,7 @@ ${IssueBody}
 	} else if columnId == "PullReqResponse" {
 		const changelogPrompt = `# Instructions
 
-Based on the content provided, suggest how the "CHANGELOG.md" could be updated. The "PullReqBody" will be a git diff.
+Based on the content provided, write the "[Unreleased]" section of the changelog. The "PullReqBody" gives the current content of the section, any problems with the pull request's changelog update, and the git diff of the pull request.
 
 # Changelog
 
@@ -100,34 +118,35 @@ The format is based on [Keep a Changelog](https://keepachangelog.com/en/1.0.0/).
 ## Example 1
 
 ### Pull Request Body
-File: dummy-file-1.txt
-Changes: @@ -0,0 +1 @@
-+This is a dummy file for branch dummy-branch-1
-\ No newline at end of file
+The user did not update their CHANGELOG.md file. The [Unreleased] section currently reads:
 
-File: dummy-secrets.txt
-Changes: @@ -0,0 +1 @@
-+SECRET_KEY=12345-abcde-67890-fghij
-\ No newline at end of file
+### CHANGED / FIXED
 
-### Your response:
+- Fixed the pagination of the table list
 
-# Suggested Changelog:
+Write the section with an entry for the following changes:
 
-## [Unreleased]
+File: services/embeddings.py
+Changes: @@ -0,0 +1,3 @@
++def embed(texts):
++    """Returns a vector representation of every text, not normalized."""
++    return model.encode(texts)
+
+### Your response:
 
 ### ADDED
 
-"Embeddings" endpoint
+- "Embeddings" endpoint to get a vector representation of a given input that can be easily consumed by machine learning models and algorithms. Note that the vectors are NOT normalized.
+
+### CHANGED / FIXED
 
-- Get a vector representation of a given input that can be easily consumed by machine learning models and algorithms. Note that the vectors are NOT normalized.
-- Similar to OpenAI's embeddings endpoint
+- Fixed the pagination of the table list
 
 # Your Task
 
-Analyze the git diff described in User Input and suggest appropriate updates to the "CHANGELOG.md" in the same format as the examples above.
+Analyze the git diff described in User Input and write the "[Unreleased]" section in the same format as the example above. Keep the entries the section already has, fix the problems listed, and add entries for the changes.
 
-Ensure your response is clear and concise, providing meaningful and insightful updates that accurately reflect the changes described in the git diff.
+Respond with the content of the section only: "###" section headings, each followed by "-" entries. Do NOT include the "## [Unreleased]" heading, code fences, or any other words, as your response is committed to the changelog as it is. Keep the entries clear and concise, accurately reflecting the changes described in the git diff.
 
 # User Input
 ${PullReqBody}`
@@ -135,7 +154,7 @@ ${PullReqBody}`
 		return []models.Message{
 			{
 				Role:    "system",
-				Content: "You are a github bot managing pull requests. Keep your responses brief and short.",
+				Content: personaPrompt(persona, "a github bot managing pull requests", " Keep your responses brief and short.", false),
 			},
 			{
 				Role:    "user",
@@ -148,6 +167,8 @@ ${PullReqBody}`
 
 Based on the diff provided, check if there are any sensitive keys, secrets, passwords, or information accidentally added. Note that the leak can be in any form. Note that a commit SHA is NOT a secret leak. Also, check if the users are correctly utilizing environment variables instead of directly adding secrets into the code. If there is, provide the commit SHA where it was leaked, and the suspected section and file name.
 
+If the input lists values flagged by an automated scanner, give a separate verdict for each of them, naming its file and line and whether it is a real secret. One real secret does not make the other flagged values secrets.
+
 # Response Template
 
 Your response must be in plain text.
@@ -282,7 +303,7 @@ ${PullReqSecretsBody}
 		return []models.Message{
 			{
 				Role:    "system",
-				Content: "You are Jambu, a github bot. Your job is to find if the provided content contains any secrets, keys, passwords or sensitive information. Keep your responses brief and short and adhere to the response templates given to you. You will not mention anything else other than the requested response. Your responses should start with a short pun of your name in the form of a greeting.",
+				Content: personaPrompt(persona, "a github bot", " Your job is to find if the provided content contains any secrets, keys, passwords or sensitive information. Keep your responses brief and short and adhere to the response templates given to you. You will not mention anything else other than the requested response.", true),
 			},
 			{
 				Role:    "user",
@@ -306,9 +327,14 @@ Your response must be in the template of:
 {
   "leak": true or false,
   "commit": "the SHA of the leaked commit, if any.",
-  "response": "The file name, your response on the suspected leak."
+  "response": "The file name, your response on the suspected leak.",
+  "candidates": [
+    {"file": "the file name of a flagged value", "line": the line number of the flagged value, "leak": true or false, "reason": "why the value is or is not a real secret."}
+  ]
 }
 
+List every flagged value the plain text response gives a verdict on in "candidates". "leak" is true only if at least one of the candidates is a leak.
+
 # Examples
 
 ## Example 1
@@ -320,7 +346,8 @@ Jambo! I am Jambu, your github assistant. There are no leaks detected in Commit
 {
   "leak": false,
   "commit": "da0ab0ba3330ac795276ebbbe4f4d3efda346c05",
-  "response": "CHANGELOG.md mentioned secrets obfuscation but no keys were found."
+  "response": "CHANGELOG.md mentioned secrets obfuscation but no keys were found.",
+  "candidates": []
 }
 
 ## Example 2
@@ -332,21 +359,24 @@ Jamboree! No suspected leaks found in Commit: 90ea6326f26465cf4ea71d7393fcc0bbb7
 {
   "leak": false,
   "commit": "90ea6326f26465cf4ea71d7393fcc0bbb7053608",
-  "response": "No suspected leaks found."
+  "response": "No suspected leaks found.",
+  "candidates": []
 }
 
 ## Example 3
 ### Plain Text Response
-Jambo! I am Jambu, your github assistant. I suspect a secret key leaked in client.py. If this is not a false positive, please squash your commits!
+Jambo! I am Jambu, your github assistant. I suspect a secret key leaked in client.py line 12, the value assigned to api_key looks like a real key. The value on client.py line 30 is a SHA-256 checksum, not a secret. If this is not a false positive, please squash your commits!
 
 ### JSON Response
 
 {
   "leak": true,
-  Jambo! I am Jambu, your github assistant. In Commit SHA: 90ea6326f26465cf4ea71d7393fcc0bbb7053608, I suspect a secret key leaked in client.py. If this is not a false positive, please squash your commits!
-
   "commit": "",
-  "response": "I suspect a secret key leaked in client.py. If this is not a false positive, please squash your commits!"
+  "response": "I suspect a secret key leaked in client.py. If this is not a false positive, please squash your commits!",
+  "candidates": [
+    {"file": "client.py", "line": 12, "leak": true, "reason": "The value assigned to api_key looks like a real key."},
+    {"file": "client.py", "line": 30, "leak": false, "reason": "The value is a SHA-256 checksum."}
+  ]
 }
 
 # Actual Plain Text Response
@@ -1,42 +1,132 @@
 package utils
 
 import (
+	"bytes"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
-// DecodePrivateKey decodes a base64 encoded RSA private key and returns the parsed rsa.PrivateKey.
-func DecodePrivateKey(privateKeyBase64 string) (*rsa.PrivateKey, error) {
-	// Decode the base64 encoded private key
-	privateKeyDecoded, err := base64.StdEncoding.DecodeString(privateKeyBase64)
+// Environment variables the GitHub App private key is loaded from.
+const (
+	privateKeyEnv     = "TRIAGE_BOT_PRIVATE_KEY"
+	privateKeyFileEnv = "TRIAGE_BOT_PRIVATE_KEY_FILE"
+)
+
+// LoadPrivateKey loads the GitHub App private key from the file named by TRIAGE_BOT_PRIVATE_KEY_FILE,
+// or from the TRIAGE_BOT_PRIVATE_KEY environment variable if no file is configured.
+// See ParsePrivateKey for the accepted formats.
+func LoadPrivateKey() (*rsa.PrivateKey, error) {
+	if path := os.Getenv(privateKeyFileEnv); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading private key file %s from %s: %v", path, privateKeyFileEnv, err)
+		}
+		privateKey, err := ParsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key in file %s: %v", path, err)
+		}
+		return privateKey, nil
+	}
+
+	value := os.Getenv(privateKeyEnv)
+	if value == "" {
+		return nil, fmt.Errorf("no private key configured, set %s or %s", privateKeyFileEnv, privateKeyEnv)
+	}
+	privateKey, err := ParsePrivateKey([]byte(value))
 	if err != nil {
-		return nil, fmt.Errorf("error decoding private key: %v", err)
+		return nil, fmt.Errorf("invalid private key in %s: %v", privateKeyEnv, err)
+	}
+	return privateKey, nil
+}
+
+// DecodePrivateKey decodes an RSA private key given as a string and returns the parsed rsa.PrivateKey.
+// It accepts the same formats as ParsePrivateKey.
+func DecodePrivateKey(privateKey string) (*rsa.PrivateKey, error) {
+	return ParsePrivateKey([]byte(privateKey))
+}
+
+// ParsePrivateKey parses an RSA private key given either as raw PEM or as base64 encoded PEM,
+// with the key itself in PKCS#1 ("RSA PRIVATE KEY") or PKCS#8 ("PRIVATE KEY") form.
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("private key is empty")
+	}
+
+	// Secret stores often flatten PEM files into a single line with escaped newlines
+	if !bytes.Contains(data, []byte("\n")) {
+		data = bytes.ReplaceAll(data, []byte(`\n`), []byte("\n"))
+	}
+
+	pemData := data
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		// Decode the base64 encoded private key
+		decoded, err := decodeBase64(data)
+		if err != nil {
+			return nil, fmt.Errorf("private key is neither PEM nor base64 encoded PEM: %v", err)
+		}
+		if !bytes.Contains(decoded, []byte("-----BEGIN")) {
+			return nil, fmt.Errorf("private key is base64 encoded but does not contain a PEM block")
+		}
+		pemData = decoded
 	}
 
 	// Decode the PEM block containing the private key
-	block, _ := pem.Decode(privateKeyDecoded)
-	if block == nil || block.Type != "RSA PRIVATE KEY" {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
 		return nil, fmt.Errorf("failed to decode PEM block containing private key")
 	}
 
-	// Parse the RSA private key
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing private key: %v", err)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		// Parse the PKCS#1 RSA private key
+		privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing PKCS#1 private key: %v", err)
+		}
+		return privateKey, nil
+	case "PRIVATE KEY":
+		// Parse the PKCS#8 private key, which may hold any key algorithm
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing PKCS#8 private key: %v", err)
+		}
+		privateKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("PKCS#8 private key is of type %T, GitHub Apps require an RSA key", key)
+		}
+		return privateKey, nil
+	case "ENCRYPTED PRIVATE KEY":
+		return nil, fmt.Errorf("private key is encrypted, decrypt it before configuring the bot")
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q, expected \"RSA PRIVATE KEY\" or \"PRIVATE KEY\"", block.Type)
 	}
+}
 
-	return privateKey, nil
+// decodeBase64 decodes standard base64, with or without padding, ignoring any embedded whitespace.
+func decodeBase64(data []byte) ([]byte, error) {
+	compact := bytes.Join(bytes.Fields(data), nil)
+	decoded, err := base64.StdEncoding.DecodeString(string(compact))
+	if err != nil {
+		decoded, err = base64.RawStdEncoding.DecodeString(string(compact))
+	}
+	return decoded, err
 }
 
 // GenerateJWT generates a JSON Web Token (JWT) signed with the given RSA private key for a GitHub App.
 func GenerateJWT(appID int64, key *rsa.PrivateKey) (string, error) {
-	now := time.Now()
+	return GenerateJWTAt(appID, key, time.Now())
+}
+
+// GenerateJWTAt generates a GitHub App JWT as if it were issued at the given time.
+func GenerateJWTAt(appID int64, key *rsa.PrivateKey, now time.Time) (string, error) {
 	claims := jwt.StandardClaims{
 		IssuedAt:  now.Unix(),
 		ExpiresAt: now.Add(time.Minute * 10).Unix(),
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"github.com/google/go-github/v41/github"
+)
+
+// maxPerPage is the largest page size the GitHub REST API accepts.
+const maxPerPage = 100
+
+// ListAll calls a go-github list function page by page, with the largest page size, and returns the items of
+// every page. The function is called with the options of the page to fetch and passes them on to go-github.
+func ListAll[T any](list func(opts *github.ListOptions) ([]T, *github.Response, error)) ([]T, error) {
+	var all []T
+	opts := &github.ListOptions{PerPage: maxPerPage}
+	for {
+		items, resp, err := list(opts)
+		if err != nil {
+			return all, err
+		}
+		all = append(all, items...)
+		if resp == nil || resp.NextPage == 0 {
+			return all, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-github/v41/github"
+)
+
+func TestListAll(t *testing.T) {
+	pages := map[int][]int{0: {1, 2}, 2: {3, 4}, 3: {5}}
+	next := map[int]int{0: 2, 2: 3}
+	var requested []int
+	items, err := ListAll(func(opts *github.ListOptions) ([]int, *github.Response, error) {
+		if opts.PerPage != maxPerPage {
+			t.Errorf("got page size %d, want %d", opts.PerPage, maxPerPage)
+		}
+		requested = append(requested, opts.Page)
+		return pages[opts.Page], &github.Response{NextPage: next[opts.Page]}, nil
+	})
+	if err != nil {
+		t.Fatalf("ListAll: %v", err)
+	}
+	if len(items) != 5 || items[0] != 1 || items[4] != 5 {
+		t.Errorf("got items %v, want 1 to 5", items)
+	}
+	if len(requested) != 3 || requested[1] != 2 || requested[2] != 3 {
+		t.Errorf("got pages %v, want 0, 2 and 3", requested)
+	}
+}
+
+func TestListAllStopsAtError(t *testing.T) {
+	calls := 0
+	items, err := ListAll(func(opts *github.ListOptions) ([]string, *github.Response, error) {
+		calls++
+		if opts.Page == 2 {
+			return nil, nil, errors.New("rate limited")
+		}
+		return []string{"first"}, &github.Response{NextPage: 2}, nil
+	})
+	if err == nil || calls != 2 || len(items) != 1 {
+		t.Errorf("got %v after %d calls with items %v, want the error after the second page and the first page's items", err, calls, items)
+	}
+
+	items, err = ListAll(func(opts *github.ListOptions) ([]string, *github.Response, error) {
+		return []string{"only"}, nil, nil
+	})
+	if err != nil || len(items) != 1 {
+		t.Errorf("got %v, %v without a response, want the single page", items, err)
+	}
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	globCacheMu sync.Mutex
+	globCache   = map[string]*regexp.Regexp{}
+)
+
+// MatchGlob reports whether a slash-separated repository path matches a glob pattern.
+// "*" and "?" match within a path segment and "**" matches across segments, so "tests/**" matches
+// everything below tests and "**/fixtures/*.pem" matches in any directory. A pattern without a slash
+// matches the file name in any directory, and a pattern ending in a slash matches everything below that directory.
+func MatchGlob(pattern, filePath string) bool {
+	pattern = strings.TrimPrefix(strings.TrimSpace(pattern), "/")
+	filePath = strings.TrimPrefix(filePath, "/")
+	if pattern == "" {
+		return false
+	}
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	if !strings.Contains(pattern, "/") {
+		return globRegexp(pattern).MatchString(path.Base(filePath))
+	}
+	return globRegexp(pattern).MatchString(filePath)
+}
+
+// MatchAnyGlob reports whether a path matches any of the glob patterns.
+func MatchAnyGlob(patterns []string, filePath string) bool {
+	for _, pattern := range patterns {
+		if MatchGlob(pattern, filePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// globRegexp translates a glob pattern into an anchored regular expression, caching the result.
+func globRegexp(pattern string) *regexp.Regexp {
+	globCacheMu.Lock()
+	defer globCacheMu.Unlock()
+	if re, ok := globCache[pattern]; ok {
+		return re
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				// "**/" also matches no directory at all
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					expr.WriteString("(?:.*/)?")
+				} else {
+					expr.WriteString(".*")
+				}
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	re := regexp.MustCompile(expr.String())
+	globCache[pattern] = re
+	return re
+}
@@ -0,0 +1,48 @@
+package utils
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.pem", "key.pem", true},
+		{"*.pem", "certs/dev/key.pem", true},
+		{"*.pem", "key.pem.bak", false},
+		{"go.sum", "tools/go.sum", true},
+		{"docs/*.md", "docs/a.md", true},
+		{"docs/*.md", "docs/sub/a.md", false},
+		{"docs/**", "docs/sub/a.md", true},
+		{"docs/", "docs/sub/a.md", true},
+		{"docs/", "mydocs/a.md", false},
+		{"**/fixtures/*.pem", "fixtures/a.pem", true},
+		{"**/fixtures/*.pem", "a/b/fixtures/a.pem", true},
+		{"**/fixtures/*.pem", "a/fixtures/sub/a.pem", false},
+		{"src/**/gen.go", "src/gen.go", true},
+		{"src/**/gen.go", "src/a/b/gen.go", true},
+		{"/build/*.js", "build/app.js", true},
+		{"build/*.js", "src/build/app.js", false},
+		{"file?.txt", "file1.txt", true},
+		{"file?.txt", "file10.txt", false},
+		{"a+b(c).txt", "a+b(c).txt", true},
+		{"", "anything", false},
+		{"  *.lock ", "yarn.lock", true},
+	}
+	for _, test := range tests {
+		if got := MatchGlob(test.pattern, test.path); got != test.want {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", test.pattern, test.path, got, test.want)
+		}
+	}
+}
+
+func TestMatchAnyGlob(t *testing.T) {
+	patterns := []string{"*.min.js", "vendor/"}
+	if !MatchAnyGlob(patterns, "vendor/lib/a.go") || !MatchAnyGlob(patterns, "web/app.min.js") {
+		t.Error("MatchAnyGlob missed a matching pattern")
+	}
+	if MatchAnyGlob(patterns, "web/app.js") || MatchAnyGlob(nil, "web/app.js") {
+		t.Error("MatchAnyGlob matched without a matching pattern")
+	}
+}
@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// minRedactedLength is the shortest value that is registered for redaction, shorter ones would mask ordinary words.
+	minRedactedLength = 6
+	// maxMaskPrefix is the most characters of a secret that are left readable, so that it can still be identified.
+	maxMaskPrefix = 4
+)
+
+// Redactor masks secret values in text before it leaves the process, either as values registered
+// once they are detected or as matches of patterns for well-known secret formats. It is safe for concurrent use.
+type Redactor struct {
+	mu       sync.RWMutex
+	values   map[string]bool
+	sorted   []string // Registered values, longest first so that overlapping values are masked as a whole.
+	patterns []*regexp.Regexp
+	parent   *Redactor // The redactor whose values and patterns are masked as well, if any.
+}
+
+// DefaultRedactor is the redactor applied to log output, and to text outside of an event. It holds the patterns of
+// well-known secret formats. Values detected while handling an event are registered with the event's redactor.
+var DefaultRedactor = NewRedactor()
+
+// NewRedactor creates an empty redactor.
+func NewRedactor() *Redactor {
+	return &Redactor{values: map[string]bool{}}
+}
+
+// redactorKey is the context key of the redactor of an event.
+type redactorKey struct{}
+
+// WithRedactor returns a context that carries a new redactor for a single event, on top of the default one.
+// Values detected in the event are only masked in what the event sends, so that a long-running server neither
+// accumulates them nor masks them in the output of unrelated repositories.
+func WithRedactor(ctx context.Context) context.Context {
+	redactor := NewRedactor()
+	redactor.parent = DefaultRedactor
+	return context.WithValue(ctx, redactorKey{}, redactor)
+}
+
+// RedactorFrom returns the redactor of the event the context belongs to, or the default redactor outside of an event.
+func RedactorFrom(ctx context.Context) *Redactor {
+	if redactor, ok := ctx.Value(redactorKey{}).(*Redactor); ok {
+		return redactor
+	}
+	return DefaultRedactor
+}
+
+// RegisterSecret adds a value to the redactor. Values shorter than six characters are ignored.
+// In GitHub Actions, the value is also masked in the job log by the runner itself.
+func (r *Redactor) RegisterSecret(value string) {
+	value = strings.TrimSpace(value)
+	if len(value) < minRedactedLength {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.values[value] {
+		return
+	}
+	r.values[value] = true
+	r.sorted = append(r.sorted, value)
+	sort.Slice(r.sorted, func(i, j int) bool { return len(r.sorted[i]) > len(r.sorted[j]) })
+
+	if os.Getenv("GITHUB_ACTIONS") == "true" && !strings.ContainsAny(value, "\r\n") {
+		fmt.Fprintf(os.Stdout, "::add-mask::%s\n", value)
+	}
+}
+
+// RegisterPattern adds a pattern for a well-known secret format. If the pattern has a group,
+// only the group is masked, otherwise the whole match.
+func (r *Redactor) RegisterPattern(pattern *regexp.Regexp) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patterns = append(r.patterns, pattern)
+}
+
+// Redact masks every registered value and pattern match in the text.
+func (r *Redactor) Redact(text string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, value := range r.sorted {
+		if strings.Contains(text, value) {
+			text = strings.ReplaceAll(text, value, MaskSecret(value))
+		}
+	}
+	for _, pattern := range r.patterns {
+		text = redactPattern(pattern, text)
+	}
+	if r.parent != nil {
+		text = r.parent.Redact(text)
+	}
+	return text
+}
+
+// redactPattern masks the matches of one pattern, or their first group if the pattern has one.
+func redactPattern(pattern *regexp.Regexp, text string) string {
+	matches := pattern.FindAllStringSubmatchIndex(text, -1)
+	if matches == nil {
+		return text
+	}
+
+	var redacted strings.Builder
+	last := 0
+	for _, match := range matches {
+		start, end := match[0], match[1]
+		if len(match) >= 4 && match[2] >= 0 {
+			start, end = match[2], match[3]
+		}
+		redacted.WriteString(text[last:start])
+		redacted.WriteString(MaskSecret(text[start:end]))
+		last = end
+	}
+	redacted.WriteString(text[last:])
+	return redacted.String()
+}
+
+// MaskSecret replaces all but a short prefix of a secret with asterisks, keeping its length.
+// At most a quarter of the value and never more than four characters stay readable.
+func MaskSecret(value string) string {
+	prefix := len(value) / 4
+	if prefix > maxMaskPrefix {
+		prefix = maxMaskPrefix
+	}
+	return value[:prefix] + strings.Repeat("*", len(value)-prefix)
+}
+
+// RegisterSecret adds a value to the redactor of the event the context belongs to.
+func RegisterSecret(ctx context.Context, value string) {
+	RedactorFrom(ctx).RegisterSecret(value)
+}
+
+// Redact masks secrets in the text with the redactor of the event the context belongs to.
+func Redact(ctx context.Context, text string) string {
+	return RedactorFrom(ctx).Redact(text)
+}
+
+// redactingWriter masks secrets in everything written through it.
+type redactingWriter struct {
+	redactor *Redactor
+	out      io.Writer
+}
+
+// NewRedactingWriter wraps a writer, such as the output of the log package, with the default redactor.
+// It does not know the values detected in an event: in GitHub Actions the runner masks them, see
+// Redactor.RegisterSecret, and text that may quote them is redacted with the event's redactor before it is logged.
+// Each write is redacted on its own, which fits the log package's one write per message.
+func NewRedactingWriter(out io.Writer) io.Writer {
+	return &redactingWriter{redactor: DefaultRedactor, out: out}
+}
+
+// Write redacts p and writes it to the underlying writer. It reports the length of p on success,
+// as masking never changes the length of the text.
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.out, w.redactor.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
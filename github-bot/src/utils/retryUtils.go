@@ -0,0 +1,221 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of sending a request while a service is considered unavailable.
+var ErrCircuitOpen = errors.New("circuit breaker is open, service is unavailable")
+
+// CircuitBreaker stops requests to a service after a run of consecutive failures, and lets requests
+// through again once the cooldown has passed. A failure after the cooldown re-opens it immediately.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+}
+
+// NewCircuitBreaker creates a circuit breaker that opens after threshold consecutive failures.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Allow returns ErrCircuitOpen if the breaker is open and its cooldown has not passed yet.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures >= b.threshold && time.Since(b.openedAt) < b.cooldown {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// Success records a successful request and closes the breaker.
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+}
+
+// Failure records a failed request, opening the breaker once the threshold is reached.
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= b.threshold {
+		if b.failures == b.threshold {
+			log.Printf("Circuit breaker opened after %d consecutive failures", b.failures)
+		}
+		b.openedAt = time.Now()
+	}
+}
+
+// RetryPolicy defines how often and how long requests are retried.
+type RetryPolicy struct {
+	MaxAttempts int           // The maximum number of attempts, including the first one.
+	BaseDelay   time.Duration // The backoff before the first retry, doubled on every further retry.
+	MaxDelay    time.Duration // The upper bound of the exponential backoff and of delays asked for with Retry-After.
+	Timeout     time.Duration // The deadline of each attempt, including reading the response body.
+}
+
+// DefaultRetryPolicy returns the retry policy for LLM requests. The per-attempt deadline and the number
+// of attempts can be changed with TRIAGE_BOT_LLM_TIMEOUT (e.g. "5m") and TRIAGE_BOT_LLM_MAX_ATTEMPTS.
+func DefaultRetryPolicy() RetryPolicy {
+	policy := RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   time.Second,
+		MaxDelay:    30 * time.Second,
+		Timeout:     5 * time.Minute,
+	}
+	if value := os.Getenv("TRIAGE_BOT_LLM_TIMEOUT"); value != "" {
+		if timeout, err := time.ParseDuration(value); err == nil {
+			policy.Timeout = timeout
+		} else {
+			log.Printf("Error parsing TRIAGE_BOT_LLM_TIMEOUT, using %s: %v", policy.Timeout, err)
+		}
+	}
+	if value := os.Getenv("TRIAGE_BOT_LLM_MAX_ATTEMPTS"); value != "" {
+		if attempts, err := strconv.Atoi(value); err == nil && attempts > 0 {
+			policy.MaxAttempts = attempts
+		} else {
+			log.Printf("Error parsing TRIAGE_BOT_LLM_MAX_ATTEMPTS, using %d", policy.MaxAttempts)
+		}
+	}
+	return policy
+}
+
+// isRetryableStatus reports whether a response status indicates a transient failure.
+func isRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// DoWithRetry sends the request built by newRequest, retrying network errors and 429, 502, 503 and 504
+// responses with exponential backoff and jitter, honoring Retry-After. Each attempt runs under its own
+// deadline, which stays in effect until the returned response body is closed.
+//
+// The final response is returned whatever its status, so callers still check the status code.
+// Server errors and network failures count against the circuit breaker, which may reject the request
+// up front with ErrCircuitOpen.
+func DoWithRetry(ctx context.Context, client *http.Client, breaker *CircuitBreaker, policy RetryPolicy, newRequest func(ctx context.Context) (*http.Request, error)) (*http.Response, error) {
+	var lastErr error
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if err := breaker.Allow(); err != nil {
+			return nil, err
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, policy.Timeout)
+		req, err := newRequest(attemptCtx)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("error creating request: %w", err)
+		}
+
+		resp, err := client.Do(req)
+		var delay time.Duration
+		switch {
+		case err != nil:
+			cancel()
+			breaker.Failure()
+			lastErr = fmt.Errorf("error sending request: %w", err)
+		case isRetryableStatus(resp.StatusCode):
+			if resp.StatusCode != http.StatusTooManyRequests {
+				breaker.Failure()
+			}
+			delay = retryAfter(resp)
+			bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+			cancel()
+			lastErr = fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(bodyBytes))
+		default:
+			if resp.StatusCode >= http.StatusInternalServerError {
+				breaker.Failure()
+			} else {
+				breaker.Success()
+			}
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+
+		// Stop if the caller gave up, or there are no attempts left
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt == policy.MaxAttempts {
+			break
+		}
+
+		if delay == 0 {
+			delay = backoff(policy, attempt)
+		}
+		// A server may ask for any delay, never wait longer than the backoff would or than the caller has left
+		if delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+		if deadline, ok := ctx.Deadline(); ok && delay > time.Until(deadline) {
+			delay = time.Until(deadline)
+		}
+		log.Printf("Request to %s failed (attempt %d/%d), retrying in %s: %v", req.URL.Host, attempt, policy.MaxAttempts, delay, lastErr)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	return nil, fmt.Errorf("giving up after %d attempts: %w", policy.MaxAttempts, lastErr)
+}
+
+// backoff returns a randomized exponential backoff for the given attempt ("full jitter").
+func backoff(policy RetryPolicy, attempt int) time.Duration {
+	ceiling := policy.BaseDelay << (attempt - 1)
+	if ceiling <= 0 || ceiling > policy.MaxDelay {
+		ceiling = policy.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(ceiling))) + time.Millisecond
+}
+
+// retryAfter returns the delay requested by a Retry-After header, either in seconds or as an HTTP date.
+func retryAfter(resp *http.Response) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// cancelOnClose releases the deadline of a request once its response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the response body and cancels the request context.
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDoWithRetryCapsRetryAfter(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	policy := RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: 50 * time.Millisecond, Timeout: time.Second}
+	start := time.Now()
+	resp, err := DoWithRetry(context.Background(), server.Client(), NewCircuitBreaker(5, time.Minute), policy, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	})
+	if err != nil {
+		t.Fatalf("DoWithRetry: %v", err)
+	}
+	resp.Body.Close()
+	if attempts != 2 {
+		t.Errorf("got %d attempts, want 2", attempts)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("waited %s for Retry-After, want at most the policy's MaxDelay", elapsed)
+	}
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// signaturePrefix is the algorithm prefix GitHub puts in front of the X-Hub-Signature-256 header value.
+const signaturePrefix = "sha256="
+
+// VerifyWebhookSignature checks the X-Hub-Signature-256 header of a webhook delivery against
+// the HMAC-SHA256 of the raw payload computed with the configured webhook secret.
+func VerifyWebhookSignature(payload []byte, signatureHeader, secret string) error {
+	if secret == "" {
+		return fmt.Errorf("webhook secret is not configured")
+	}
+	if !strings.HasPrefix(signatureHeader, signaturePrefix) {
+		return fmt.Errorf("missing or malformed X-Hub-Signature-256 header")
+	}
+
+	// Decode the hex encoded signature sent by GitHub
+	signature, err := hex.DecodeString(strings.TrimPrefix(signatureHeader, signaturePrefix))
+	if err != nil {
+		return fmt.Errorf("error decoding signature: %v", err)
+	}
+
+	// Compute the expected signature and compare in constant time
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return fmt.Errorf("signature does not match payload")
+	}
+	return nil
+}
+
+// SignWebhookPayload computes the "sha256=" prefixed HMAC-SHA256 signature of a payload, in the same format
+// GitHub uses for X-Hub-Signature-256, so that receivers of the bot's own webhooks can verify them.
+func SignWebhookPayload(payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
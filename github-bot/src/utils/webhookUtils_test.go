@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	payload := []byte(`{"action":"opened"}`)
+	valid := SignWebhookPayload(payload, "webhook-secret")
+	tests := []struct {
+		name      string
+		signature string
+		secret    string
+		wantErr   string
+	}{
+		{"valid signature", valid, "webhook-secret", ""},
+		{"missing header", "", "webhook-secret", "missing or malformed"},
+		{"SHA-1 prefix", "sha1=" + strings.TrimPrefix(valid, "sha256="), "webhook-secret", "missing or malformed"},
+		{"bad hex", "sha256=not-hex", "webhook-secret", "error decoding signature"},
+		{"other secret", valid, "other-secret", "does not match"},
+		{"truncated signature", valid[:len(valid)-2], "webhook-secret", "does not match"},
+		{"empty secret", valid, "", "not configured"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := VerifyWebhookSignature(payload, test.signature, test.secret)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("got error %v, want none", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got error %v, want one containing %q", err, test.wantErr)
+			}
+		})
+	}
+
+	if err := VerifyWebhookSignature([]byte(`{"action":"closed"}`), valid, "webhook-secret"); err == nil {
+		t.Error("got no error for a signature of another payload")
+	}
+}